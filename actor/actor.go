@@ -0,0 +1,404 @@
+package actor
+
+import (
+	"errors"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/skeletongo/leaf.v1/chanrpc"
+	"github.com/skeletongo/leaf.v1/conf"
+	"github.com/skeletongo/leaf.v1/log"
+)
+
+var (
+	ErrActorExists   = errors.New("actor already exists")
+	ErrActorNotFound = errors.New("actor not found")
+	ErrMailboxFull   = errors.New("actor mailbox full")
+)
+
+// System 一组 actor，调度到固定数量的工作协程上执行
+// 每个 actor 的消息、定时器和异步调用回调串行执行，不同 actor 之间并行
+type System struct {
+	Workers      int // 工作协程数，默认 runtime.NumCPU()
+	MailboxLen   int // 每个 actor 的邮箱长度，默认 100，邮箱满时 Send、Post 返回 ErrMailboxFull，不阻塞发送方
+	Throughput   int // actor 每次被调度时最多处理的消息数，默认 100，防止个别 actor 占用工作协程
+	AsyncCallLen int // 每个 actor 未返回的 AsyncCall 数量上限，默认 100，超出时回调收到 chanrpc.ErrTooManyCalls
+
+	// 路由服务，通过 Route 注册的调用转发给对应的 actor
+	// 可以用作 gate 消息的路由，例如 Processor.SetRouter(msg, sys.ChanRPCServer)
+	ChanRPCServer *chanrpc.Server
+
+	muActors sync.RWMutex
+	actors   map[interface{}]*Actor
+	live     sync.WaitGroup // 未停止的 actor
+
+	mu     sync.Mutex
+	cond   *sync.Cond
+	queue  []*Actor // 有消息待处理的 actor
+	closed bool
+	wg     sync.WaitGroup // 工作协程
+}
+
+// Actor 拥有独立邮箱的实体，例如一个玩家或者一个房间
+// 邮箱是一个 chanrpc.Server，其它模块可以直接对它 Go、Call
+type Actor struct {
+	// OnStop actor 停止时在 actor 中调用
+	OnStop func()
+
+	id        interface{}
+	sys       *System
+	server    *chanrpc.Server
+	client    *chanrpc.Client // AsyncCall 的客户端，结果作为邮箱消息处理
+	scheduled int32           // 是否已经在调度队列中或者正在执行
+	stopping  int32           // 已经调用 Stop
+	stopped   bool            // 只在 actor 中读写
+
+	// 已经触发、待执行的定时器回调，不经过邮箱，邮箱已满时也不会丢失
+	muTimers sync.Mutex
+	timers   []func()
+}
+
+// 投递到邮箱中的闭包
+type post struct{}
+
+func (sys *System) Start() {
+	if sys.Workers <= 0 {
+		sys.Workers = runtime.NumCPU()
+	}
+	if sys.MailboxLen <= 0 {
+		sys.MailboxLen = 100
+	}
+	if sys.Throughput <= 0 {
+		sys.Throughput = 100
+	}
+	if sys.AsyncCallLen <= 0 {
+		sys.AsyncCallLen = 100
+	}
+	if sys.ChanRPCServer == nil {
+		sys.ChanRPCServer = chanrpc.NewServer(sys.MailboxLen)
+	}
+
+	sys.actors = make(map[interface{}]*Actor)
+	sys.cond = sync.NewCond(&sys.mu)
+
+	// 路由服务本身也作为一个 actor 调度
+	sys.newActor(nil, sys.ChanRPCServer)
+
+	for i := 0; i < sys.Workers; i++ {
+		sys.wg.Add(1)
+		go sys.work()
+	}
+}
+
+// Close 停止所有 actor，等待它们处理完邮箱中的消息后关闭工作协程
+func (sys *System) Close() {
+	sys.muActors.RLock()
+	actors := make([]*Actor, 0, len(sys.actors))
+	for _, a := range sys.actors {
+		actors = append(actors, a)
+	}
+	sys.muActors.RUnlock()
+	for _, a := range actors {
+		a.Stop()
+	}
+	sys.live.Wait()
+
+	sys.mu.Lock()
+	sys.closed = true
+	sys.cond.Broadcast()
+	sys.mu.Unlock()
+	sys.wg.Wait()
+
+	sys.ChanRPCServer.Close()
+}
+
+// 创建 actor 并设置调度，邮箱和异步调用结果有新消息时加入调度队列
+func (sys *System) newActor(id interface{}, server *chanrpc.Server) *Actor {
+	a := &Actor{
+		id:     id,
+		sys:    sys,
+		server: server,
+		client: chanrpc.NewClient(sys.AsyncCallLen),
+	}
+	server.SetNotify(a.schedule)
+	a.client.SetNotify(a.schedule)
+	return a
+}
+
+// Spawn 创建 actor，init 在调用方协程中执行，用于注册消息处理方法、设置 OnStop
+// actor 初始化完成后才能被 Get、Send 找到
+// 线程安全
+func (sys *System) Spawn(id interface{}, init func(a *Actor)) (*Actor, error) {
+	a := sys.newActor(id, chanrpc.NewServer(sys.MailboxLen))
+	a.server.Register(post{}, func(args []interface{}) {
+		args[0].(func())()
+	})
+	if init != nil {
+		init(a)
+	}
+
+	sys.muActors.Lock()
+	defer sys.muActors.Unlock()
+	if _, ok := sys.actors[id]; ok {
+		return nil, ErrActorExists
+	}
+	sys.actors[id] = a
+	sys.live.Add(1)
+	return a, nil
+}
+
+// Get 按 ID 查找 actor，找不到时返回 nil
+// 线程安全
+func (sys *System) Get(id interface{}) *Actor {
+	sys.muActors.RLock()
+	defer sys.muActors.RUnlock()
+	return sys.actors[id]
+}
+
+// Send 向 actor 发送消息，msgID 为 actor 注册的方法id
+// 不阻塞，邮箱已满时返回 ErrMailboxFull
+// 线程安全
+func (sys *System) Send(id interface{}, msgID interface{}, args ...interface{}) error {
+	a := sys.Get(id)
+	if a == nil {
+		return ErrActorNotFound
+	}
+	return a.send(msgID, args...)
+}
+
+func (a *Actor) send(id interface{}, args ...interface{}) error {
+	err := a.server.TryGo(id, args...)
+	if errors.Is(err, chanrpc.ErrQueueFull) {
+		return ErrMailboxFull
+	}
+	return err
+}
+
+// Route 在 ChanRPCServer 上注册 msgID，调用转发给 actorOf 返回的 actor 的同名方法
+// 例如 gate 消息的参数为 [msg, agent]，可以按 agent.UserData() 中的玩家 ID 转发给玩家的 actor
+// 线程安全
+func (sys *System) Route(msgID interface{}, actorOf func(args []interface{}) interface{}) {
+	sys.ChanRPCServer.Register(msgID, func(args []interface{}) {
+		id := actorOf(args)
+		if err := sys.Send(id, msgID, args...); err != nil {
+			log.Debug("route %v to actor %v: %v", msgID, id, err)
+		}
+	})
+}
+
+func (sys *System) push(a *Actor) {
+	sys.mu.Lock()
+	sys.queue = append(sys.queue, a)
+	sys.cond.Signal()
+	sys.mu.Unlock()
+}
+
+func (sys *System) pop() *Actor {
+	sys.mu.Lock()
+	defer sys.mu.Unlock()
+	for len(sys.queue) == 0 && !sys.closed {
+		sys.cond.Wait()
+	}
+	if len(sys.queue) == 0 {
+		return nil
+	}
+	a := sys.queue[0]
+	sys.queue[0] = nil
+	sys.queue = sys.queue[1:]
+	return a
+}
+
+func (sys *System) work() {
+	defer sys.wg.Done()
+	for {
+		a := sys.pop()
+		if a == nil {
+			return
+		}
+		a.run(sys.Throughput)
+	}
+}
+
+// ID actor 的 ID
+func (a *Actor) ID() interface{} {
+	return a.id
+}
+
+// Server actor 的邮箱，其它模块可以直接调用
+func (a *Actor) Server() *chanrpc.Server {
+	return a.server
+}
+
+// Register 注册消息处理方法，方法在 actor 中执行
+// 线程安全
+func (a *Actor) Register(id, f interface{}) {
+	a.server.Register(id, f)
+}
+
+// Post 在 actor 中执行 f
+// 不阻塞，邮箱已满时返回 ErrMailboxFull，actor 已经停止时返回 chanrpc.ErrServerClosed
+// 线程安全
+func (a *Actor) Post(f func()) error {
+	return a.send(post{}, f)
+}
+
+// Stop 停止 actor，邮箱中已有的消息处理完后调用 OnStop
+// 不经过邮箱，邮箱已满时也不会丢失
+// 线程安全
+func (a *Actor) Stop() {
+	a.sys.muActors.Lock()
+	if a.sys.actors[a.id] == a {
+		delete(a.sys.actors, a.id)
+	}
+	a.sys.muActors.Unlock()
+
+	if atomic.CompareAndSwapInt32(&a.stopping, 0, 1) {
+		a.schedule()
+	}
+}
+
+// 在 actor 中停止，未返回的 AsyncCall 结果被丢弃
+func (a *Actor) stop() {
+	a.stopped = true
+	defer a.sys.live.Done()
+	defer a.server.Close()
+	if a.OnStop != nil {
+		a.OnStop()
+	}
+}
+
+// 邮箱有新消息，加入调度队列
+func (a *Actor) schedule() {
+	if atomic.CompareAndSwapInt32(&a.scheduled, 0, 1) {
+		a.sys.push(a)
+	}
+}
+
+// 在工作协程中处理邮箱中的消息
+func (a *Actor) run(throughput int) {
+	for i := 0; i < throughput && !a.stopped; i++ {
+		if !a.exec() {
+			break
+		}
+	}
+	stopping := atomic.LoadInt32(&a.stopping) == 1
+	if !a.stopped && stopping && !a.pending() {
+		a.stop()
+	}
+	// 释放调度标记后 actor 可能已经在其它工作协程中执行，不能再读写 stopped
+	stopped := a.stopped
+
+	atomic.StoreInt32(&a.scheduled, 0)
+	// 处理期间到达的消息没有触发调度
+	if !stopped && (stopping || a.pending()) {
+		a.schedule()
+	}
+}
+
+// 处理一条消息，高优先级的优先，其次是已经触发的定时器，没有消息时返回 false
+func (a *Actor) exec() bool {
+	select {
+	case ci := <-a.server.ChanCallHigh:
+		a.server.Exec(ci)
+		return true
+	default:
+	}
+	if f := a.popTimer(); f != nil {
+		safeCall(f)
+		return true
+	}
+	select {
+	case ci := <-a.server.ChanCallHigh:
+		a.server.Exec(ci)
+	case ci := <-a.server.ChanCall:
+		a.server.Exec(ci)
+	case ri := <-a.client.ChanAsyncRet:
+		a.client.Cb(ri)
+	default:
+		return false
+	}
+	return true
+}
+
+func (a *Actor) pending() bool {
+	if len(a.server.ChanCallHigh) > 0 || len(a.server.ChanCall) > 0 || len(a.client.ChanAsyncRet) > 0 {
+		return true
+	}
+	a.muTimers.Lock()
+	defer a.muTimers.Unlock()
+	return len(a.timers) > 0
+}
+
+func (a *Actor) pushTimer(f func()) {
+	a.muTimers.Lock()
+	a.timers = append(a.timers, f)
+	a.muTimers.Unlock()
+	a.schedule()
+}
+
+func (a *Actor) popTimer() func() {
+	a.muTimers.Lock()
+	defer a.muTimers.Unlock()
+	if len(a.timers) == 0 {
+		return nil
+	}
+	f := a.timers[0]
+	a.timers[0] = nil
+	a.timers = a.timers[1:]
+	return f
+}
+
+// 执行回调，异常恢复
+func safeCall(f func()) {
+	defer func() {
+		if r := recover(); r != nil {
+			if conf.LenStackBuf > 0 {
+				buf := make([]byte, conf.LenStackBuf)
+				l := runtime.Stack(buf, false)
+				log.Error("%v: %s", r, buf[:l])
+			} else {
+				log.Error("%v", r)
+			}
+		}
+	}()
+
+	f()
+}
+
+// Timer actor 的定时器
+type Timer struct {
+	t  *time.Timer
+	cb func()
+}
+
+// Stop 停止定时器，只能在 actor 中调用
+func (t *Timer) Stop() {
+	t.t.Stop()
+	t.cb = nil
+}
+
+// AfterFunc 定时器，回调在 actor 中执行
+// 触发的定时器不经过邮箱，邮箱已满时也不会丢失
+func (a *Actor) AfterFunc(d time.Duration, cb func()) *Timer {
+	t := &Timer{cb: cb}
+	t.t = time.AfterFunc(d, func() {
+		a.pushTimer(func() {
+			if cb := t.cb; cb != nil {
+				t.cb = nil
+				cb()
+			}
+		})
+	})
+	return t
+}
+
+// AsyncCall 异步调用其它模块或者 actor 的方法，最后一个参数为回调，回调在 actor 中执行
+// 回调的定义与 chanrpc.Client.AsyncCall 相同，结果作为邮箱消息送达，不占用额外的协程
+// 未返回的调用超过 AsyncCallLen 时回调立即收到 chanrpc.ErrTooManyCalls
+// 只能在 actor 中调用
+func (a *Actor) AsyncCall(server *chanrpc.Server, id interface{}, args ...interface{}) {
+	a.client.Attach(server)
+	a.client.AsyncCall(id, args...)
+}
@@ -0,0 +1,124 @@
+package actor_test
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/skeletongo/leaf.v1/actor"
+)
+
+type Move struct {
+	PlayerID int
+	X, Y     int
+}
+
+func Example() {
+	sys := &actor.System{Workers: 4}
+	sys.Start()
+
+	var wg sync.WaitGroup
+	for id := 1; id <= 2; id++ {
+		id := id
+		sys.Spawn(id, func(a *actor.Actor) {
+			var x, y int
+			a.Register("Move", func(args []interface{}) {
+				m := args[0].(*Move)
+				x, y = x+m.X, y+m.Y
+				wg.Done()
+			})
+			a.OnStop = func() {
+				fmt.Println("player", id, "at", x, y)
+			}
+		})
+	}
+
+	// 按消息中的玩家 ID 转发，gate 消息可以用 Processor.SetRouter(&Move{}, sys.ChanRPCServer) 路由过来
+	sys.Route("Move", func(args []interface{}) interface{} {
+		return args[0].(*Move).PlayerID
+	})
+
+	wg.Add(3)
+	sys.ChanRPCServer.Go("Move", &Move{PlayerID: 1, X: 1, Y: 2})
+	sys.ChanRPCServer.Go("Move", &Move{PlayerID: 1, X: 3, Y: 4})
+	sys.Send(2, "Move", &Move{PlayerID: 2, X: 5, Y: 6})
+	wg.Wait()
+
+	sys.Get(1).Stop()
+	sys.Close()
+
+	// Unordered output:
+	// player 1 at 4 6
+	// player 2 at 5 6
+}
+
+func ExampleActor_AsyncCall() {
+	sys := &actor.System{Workers: 2, MailboxLen: 1}
+	sys.Start()
+
+	// 邮箱满时 Send 不阻塞，直接返回错误
+	started, release := make(chan struct{}), make(chan struct{})
+	sys.Spawn("bank", func(a *actor.Actor) {
+		a.Register("Balance", func(args []interface{}) interface{} {
+			return 100
+		})
+		a.Register("Block", func(args []interface{}) {
+			close(started)
+			<-release
+		})
+	})
+	sys.Send("bank", "Block")
+	<-started
+	fmt.Println(sys.Send("bank", "Balance"))
+	fmt.Println(sys.Send("bank", "Balance"))
+	close(release)
+	// 同步调用排在之前的消息之后，返回时邮箱已经清空
+	sys.Get("bank").Server().Call1("Balance")
+
+	done := make(chan struct{})
+	player, _ := sys.Spawn(1, nil)
+	player.Post(func() {
+		player.AsyncCall(sys.Get("bank").Server(), "Balance", func(ret interface{}, err error) {
+			fmt.Println("balance", ret, err)
+			close(done)
+		})
+	})
+	<-done
+	sys.Close()
+
+	// Output:
+	// <nil>
+	// actor mailbox full
+	// balance 100 <nil>
+}
+
+func ExampleActor_AfterFunc() {
+	sys := &actor.System{Workers: 2, MailboxLen: 1}
+	sys.Start()
+
+	started, release, done := make(chan struct{}), make(chan struct{}), make(chan struct{})
+	a, _ := sys.Spawn(1, func(a *actor.Actor) {
+		a.Register("Block", func(args []interface{}) {
+			close(started)
+			<-release
+		})
+		a.Register("Noop", func(args []interface{}) {})
+	})
+	sys.Send(1, "Block")
+	<-started
+	fmt.Println(sys.Send(1, "Noop"))
+
+	// 邮箱已满时触发的定时器不会丢失
+	a.AfterFunc(time.Millisecond, func() {
+		fmt.Println("timer")
+		close(done)
+	})
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	<-done
+	sys.Close()
+
+	// Output:
+	// <nil>
+	// timer
+}
@@ -0,0 +1,174 @@
+package leaf
+
+import (
+	"fmt"
+
+	"github.com/skeletongo/leaf.v1/cluster"
+	"github.com/skeletongo/leaf.v1/conf"
+	"github.com/skeletongo/leaf.v1/console"
+	"github.com/skeletongo/leaf.v1/log"
+	"github.com/skeletongo/leaf.v1/module"
+)
+
+// Config Leaf 实例的配置，与 conf 包中的全局配置是同一个类型
+// conf.LenStackBuf 等框架内部使用的配置仍然是全局的
+type Config = conf.Settings
+
+// DefaultConfig conf 包中的全局配置
+func DefaultConfig() Config {
+	return conf.Current()
+}
+
+// App 一个 Leaf 实例，拥有自己的模块管理、控制台和集群服务
+// 一个进程中可以运行多个实例，也可以反复创建、启动和关闭
+// Stop 之后再次 Start 时，已注册的模块重新初始化
+// 框架内部的日志、chanrpc 统计、模块状态及卡顿检测仍然是进程全局的，
+// 控制台的 module、chanrpc 等命令显示所有实例的模块
+type App struct {
+	Config Config
+	// 实例启动、关闭等信息的日志，为 nil 时按 Config 创建，实例关闭时关闭
+	// 模块、chanrpc、gate 等使用 log 包的全局日志，需要时调用 log.Export
+	Logger *log.Logger
+
+	modules  *module.Manager
+	console  *console.Console
+	cluster  *cluster.Cluster
+	ownLog   bool
+	shutdown chan string
+	started  bool
+}
+
+func NewApp(config Config) *App {
+	a := &App{
+		Config:   config,
+		modules:  new(module.Manager),
+		shutdown: make(chan string, 1),
+	}
+	// 模块抛异常且不再重启时关闭实例，而不是带着停止的模块继续运行
+	a.modules.OnFail = func(name, reason string) {
+		a.Shutdown(fmt.Sprintf("module %v failed: %v", name, reason))
+	}
+	return a
+}
+
+// Register 注册模块，需要在 Start 之前调用
+func (a *App) Register(modules ...module.Module) {
+	for _, mi := range modules {
+		a.modules.Register(mi)
+	}
+}
+
+// RegisterCommand 注册实例控制台的命令，f 在控制台协程中执行，必须线程安全
+// 需要在 Start 之前调用
+func (a *App) RegisterCommand(name, help string, f func(args []string) string) {
+	a.consoleServer().RegisterFunc(name, help, f)
+}
+
+func (a *App) consoleServer() *console.Console {
+	if a.console == nil {
+		a.console = &console.Console{
+			Port:   a.Config.ConsolePort,
+			Prompt: a.Config.ConsolePrompt,
+		}
+		a.console.RegisterFunc("shutdown", "shut down the server", func([]string) string {
+			a.Shutdown("console")
+			return "shutting down"
+		})
+	}
+	return a.console
+}
+
+// Start 初始化模块并启动集群服务和控制台
+// 模块初始化失败时已经初始化的模块被销毁，返回错误
+func (a *App) Start() error {
+	if a.started {
+		return fmt.Errorf("leaf app already started")
+	}
+
+	if a.Logger == nil && a.Config.LogLevel != "" {
+		l, err := log.New(a.Config.LogLevel, a.Config.LogPath, a.Config.LogFlag)
+		if err != nil {
+			return err
+		}
+		a.Logger = l
+		a.ownLog = true
+	}
+
+	// 丢弃上一次运行未处理的关闭通知
+	select {
+	case <-a.shutdown:
+	default:
+	}
+
+	a.release("Leaf %v starting up", version)
+
+	if err := a.modules.Init(); err != nil {
+		a.errorf("Leaf startup failed: %v", err)
+		a.closeLog()
+		return err
+	}
+
+	a.cluster = &cluster.Cluster{
+		ListenAddr:      a.Config.ListenAddr,
+		ConnAddrs:       a.Config.ConnAddrs,
+		PendingWriteNum: a.Config.PendingWriteNum,
+	}
+	a.cluster.Start()
+	a.consoleServer().Start()
+	a.started = true
+	return nil
+}
+
+// Shutdown 通知实例关闭，Wait 返回 reason
+// 线程安全，可以多次调用，只有第一次生效
+func (a *App) Shutdown(reason string) {
+	select {
+	case a.shutdown <- reason:
+	default:
+	}
+}
+
+// Wait 等待 Shutdown 被调用，返回关闭原因
+func (a *App) Wait() string {
+	return <-a.shutdown
+}
+
+// Stop 关闭控制台、集群服务和模块
+func (a *App) Stop() {
+	if !a.started {
+		return
+	}
+	a.started = false
+
+	a.console.Close()
+	a.cluster.Close()
+	a.modules.ModuleCloseTimeout = a.Config.ModuleCloseTimeout
+	a.modules.CloseTimeout = a.Config.CloseTimeout
+	a.modules.Destroy()
+	a.closeLog()
+}
+
+// 实例的日志，没有时使用全局日志
+func (a *App) release(format string, args ...interface{}) {
+	if a.Logger != nil {
+		a.Logger.Release(format, args...)
+	} else {
+		log.Release(format, args...)
+	}
+}
+
+func (a *App) errorf(format string, args ...interface{}) {
+	if a.Logger != nil {
+		a.Logger.Error(format, args...)
+	} else {
+		log.Error(format, args...)
+	}
+}
+
+func (a *App) closeLog() {
+	if a.ownLog {
+		a.Logger.Close()
+		a.Logger = nil
+		a.ownLog = false
+	}
+}
@@ -0,0 +1,116 @@
+package chanrpc
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/skeletongo/leaf.v1/trace"
+)
+
+// Bus 事件总线
+// 模块在自己的服务端上订阅主题，发布一次即分发给所有订阅者
+// 订阅者的处理方法以主题为 id 注册在服务端上，在模块协程中执行
+type Bus struct {
+	mu   sync.RWMutex
+	subs map[interface{}][]*Server
+}
+
+// Result 扇出调用中一个订阅者的结果
+type Result struct {
+	Server *Server
+	Ret    interface{} // 处理方法返回 []interface{} 时为 []interface{}
+	Err    error
+}
+
+func NewBus() *Bus {
+	return &Bus{
+		subs: make(map[interface{}][]*Server),
+	}
+}
+
+// Subscribe 订阅主题，在 server 上以 topic 为 id 注册处理方法 f
+// 线程安全
+func (b *Bus) Subscribe(topic interface{}, server *Server, f interface{}) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, s := range b.subs[topic] {
+		if s == server {
+			panic(fmt.Sprintf("topic %v: already subscribed", topic))
+		}
+	}
+	server.Register(topic, f)
+	b.subs[topic] = append(b.subs[topic], server)
+}
+
+// Unsubscribe 取消订阅，并注销 server 上的处理方法
+// 线程安全
+func (b *Bus) Unsubscribe(topic interface{}, server *Server) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	subs := b.subs[topic]
+	for i, s := range subs {
+		if s == server {
+			server.Unregister(topic)
+			b.subs[topic] = append(subs[:i:i], subs[i+1:]...)
+			return
+		}
+	}
+}
+
+func (b *Bus) subscribers(topic interface{}) []*Server {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.subs[topic]
+}
+
+// Publish 发布事件，不关心结果，各订阅者的队列已满时按其溢出策略处理
+// 线程安全
+func (b *Bus) Publish(topic interface{}, args ...interface{}) {
+	for _, s := range b.subscribers(topic) {
+		s.Go(topic, args...)
+	}
+}
+
+// Call 扇出调用，等待所有订阅者返回或者上下文超时，结果按订阅顺序排列
+// 超时未返回的订阅者结果为上下文的错误，迟到的结果被丢弃
+// 线程安全，会阻塞，在模块协程中使用 Skeleton.AsyncCallBus
+func (b *Bus) Call(ctx context.Context, topic interface{}, args ...interface{}) []*Result {
+	subs := b.subscribers(topic)
+	results := make([]*Result, len(subs))
+	cis := make([]*CallInfo, len(subs))
+	for i, s := range subs {
+		results[i] = &Result{Server: s}
+		f := s.function(topic)
+		if f == nil {
+			results[i].Err = fmt.Errorf("function id %v: %w", topic, ErrNotRegistered)
+			continue
+		}
+		ci := &CallInfo{
+			id:      topic,
+			f:       f,
+			args:    args,
+			chanRet: make(chan *RetInfo, 1),
+			ctx:     ctx,
+			span:    trace.FromContext(ctx),
+		}
+		if err := s.enqueue(ci, true); err != nil {
+			results[i].Err = err
+			continue
+		}
+		cis[i] = ci
+	}
+
+	for i, ci := range cis {
+		if ci == nil {
+			continue
+		}
+		select {
+		case ri := <-ci.chanRet:
+			results[i].Ret, results[i].Err = ri.ret, ri.err
+		case <-ctx.Done():
+			results[i].Err = ctxErr(ctx)
+		}
+	}
+	return results
+}
@@ -1,12 +1,17 @@
 package chanrpc
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/skeletongo/leaf.v1/conf"
 	"github.com/skeletongo/leaf.v1/log"
+	"github.com/skeletongo/leaf.v1/trace"
 )
 
 // Server 服务端
@@ -17,40 +22,85 @@ type Server struct {
 	// func([]interface{}) interface{}
 	// func([]interface{}) []interface{}
 	functions map[interface{}]interface{}
+	// functions、stats 的读写锁，支持运行时注销和替换方法
+	mu sync.RWMutex
 
 	// 待处理消息队列
 	ChanCall chan *CallInfo
+	// 高优先级的待处理消息队列，优先于 ChanCall 处理
+	ChanCallHigh chan *CallInfo
+	priorities   map[interface{}]Priority
+
+	// 队列溢出策略及计数
+	policy       OverflowPolicy
+	blockTimeout time.Duration
+	dropped      uint64
+	rejected     uint64
+	timeout      uint64
+
+	// 执行统计
+	stats   map[interface{}]*funcStats
+	goFails uint64 // Go、GoContext、GoPriority 失败的次数，不含溢出策略丢弃或者拒绝的调用
+
+	// 调用入队列后的通知
+	notify func()
 }
 
 // CallInfo 消息体
 type CallInfo struct {
+	id      interface{}   // 方法id
 	f       interface{}   // 方法体
 	args    []interface{} // 参数
 	chanRet chan *RetInfo // 结果接收通道
 	cb      interface{}   // 回调方法
+
+	ctx  context.Context // 调用的上下文，超时或者取消后不再执行，迟到的结果被丢弃
+	done int32           // 结果是否已经送达(含超时错误)
+	stop func() bool     // 取消上下文监听
+
+	priority Priority // 调用指定的优先级
+
+	span *trace.Span // 调用方的 span，由上下文传入
+
+	notify func() // 结果送达后的通知，来自客户端
+}
+
+// ID 方法id
+func (ci *CallInfo) ID() interface{} {
+	return ci.id
+}
+
+// Span 调用方的 span，未开启追踪或者调用未携带时为 nil
+func (ci *CallInfo) Span() *trace.Span {
+	return ci.span
 }
 
 // RetInfo 消息处理结果
 type RetInfo struct {
-	ret interface{} // 返回结果
-	err error       // 错误
-	cb  interface{} // 回调方法
+	ret  interface{} // 返回结果
+	err  error       // 错误
+	cb   interface{} // 回调方法
+	span *trace.Span // 调用方的 span
+}
+
+// Span 调用方发起调用时的 span，回调中用于延续链路
+func (ri *RetInfo) Span() *trace.Span {
+	return ri.span
 }
 
 // NewServer 创建服务端
 // l 待处理消息队列长度
 func NewServer(l int) *Server {
 	return &Server{
-		functions: make(map[interface{}]interface{}),
-		ChanCall:  make(chan *CallInfo, l),
+		functions:    make(map[interface{}]interface{}),
+		ChanCall:     make(chan *CallInfo, l),
+		ChanCallHigh: make(chan *CallInfo, l),
+		priorities:   make(map[interface{}]Priority),
+		stats:        make(map[interface{}]*funcStats),
 	}
 }
 
-// Register 注册处理方法
-func (s *Server) Register(id interface{}, f interface{}) {
-	if _, ok := s.functions[id]; ok {
-		panic(fmt.Sprintf("function id %v: already registered", id))
-	}
+func check(id interface{}, f interface{}) {
 	switch f.(type) {
 	case func([]interface{}):
 	case func([]interface{}) interface{}:
@@ -58,7 +108,50 @@ func (s *Server) Register(id interface{}, f interface{}) {
 	default:
 		panic(fmt.Sprintf("function id %v: invalid", id))
 	}
+}
+
+// Register 注册处理方法
+// 线程安全
+func (s *Server) Register(id interface{}, f interface{}) {
+	check(id, f)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.functions[id]; ok {
+		panic(fmt.Sprintf("function id %v: already registered", id))
+	}
+	s.functions[id] = f
+	s.stats[id] = new(funcStats)
+}
+
+// Unregister 注销处理方法，已经进入队列的调用仍由原方法处理
+// 线程安全
+func (s *Server) Unregister(id interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.functions, id)
+	delete(s.stats, id)
+	delete(s.priorities, id)
+}
+
+// Replace 替换处理方法，未注册时直接注册，用于运行时热更新
+// 已经进入队列的调用仍由原方法处理，执行统计保留
+// 线程安全
+func (s *Server) Replace(id interface{}, f interface{}) {
+	check(id, f)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	s.functions[id] = f
+	if _, ok := s.stats[id]; !ok {
+		s.stats[id] = new(funcStats)
+	}
+}
+
+func (s *Server) function(id interface{}) interface{} {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.functions[id]
 }
 
 func assert(i interface{}) []interface{} {
@@ -76,7 +169,17 @@ func ret(ci *CallInfo, ri *RetInfo) (err error) {
 	if ci.chanRet == nil {
 		return
 	}
+	if ci.ctx != nil {
+		// 调用已超时或者取消，错误已经送达，丢弃结果
+		if !atomic.CompareAndSwapInt32(&ci.done, 0, 1) {
+			return
+		}
+		if ci.stop != nil {
+			ci.stop()
+		}
+	}
 	ri.cb = ci.cb
+	ri.span = ci.span
 
 	// chanRet 接收通道可能已经关闭
 	defer func() {
@@ -86,73 +189,146 @@ func ret(ci *CallInfo, ri *RetInfo) (err error) {
 	}()
 
 	ci.chanRet <- ri
+	if ci.notify != nil {
+		ci.notify()
+	}
 	return
 }
 
 // 执行队列中的方法
 // 执行出错也通知客户端
+// panicked 方法执行是否抛异常
 // err 方法执行抛异常、接收通道已经关闭
-func exec(ci *CallInfo) (err error) {
+func exec(ci *CallInfo) (panicked bool, err error) {
 	// 异常恢复
 	defer func() {
 		if r := recover(); r != nil {
+			panicked = true
+			pe := &PanicError{Value: r}
 			if conf.LenStackBuf > 0 {
 				buf := make([]byte, conf.LenStackBuf)
 				l := runtime.Stack(buf, false)
-				err = fmt.Errorf("%v: %s", r, buf[:l])
+				pe.Stack = buf[:l]
+				err = fmt.Errorf("%v: %s", r, pe.Stack)
 			} else {
-				err = fmt.Errorf("%v", r)
+				err = pe
 			}
 
-			_ = ret(ci, &RetInfo{err: fmt.Errorf("%v", r)})
+			_ = ret(ci, &RetInfo{err: pe})
 		}
 	}()
 
+	if ci.ctx != nil && ci.ctx.Err() != nil {
+		return false, ret(ci, &RetInfo{err: ctxErr(ci.ctx)})
+	}
+
 	switch f := ci.f.(type) {
 	case func([]interface{}):
 		f(ci.args)
-		return ret(ci, &RetInfo{})
+		return false, ret(ci, &RetInfo{})
 	case func([]interface{}) interface{}:
-		return ret(ci, &RetInfo{ret: f(ci.args)})
+		return false, ret(ci, &RetInfo{ret: f(ci.args)})
 	case func([]interface{}) []interface{}:
-		return ret(ci, &RetInfo{ret: f(ci.args)})
+		return false, ret(ci, &RetInfo{ret: f(ci.args)})
 	}
 	panic("bug")
 }
 
 func (s *Server) Exec(ci *CallInfo) {
-	if err := exec(ci); err != nil {
-		log.Error("%v", err)
+	start := time.Now()
+	panicked, err := exec(ci)
+	s.record(ci.id, time.Since(start), panicked)
+	if err != nil {
+		log.Error("%v%v", ci.span.Tag(), err)
 	}
 }
 
 // Close 停止消息接收，处理完已经入队列的消息后关闭
 func (s *Server) Close() {
+	close(s.ChanCallHigh)
 	close(s.ChanCall)
+	for v := range s.ChanCallHigh {
+		s.Exec(v)
+	}
 	for v := range s.ChanCall {
-		//_ = ret(v, &RetInfo{err: errors.New("channel rpc server closed")})
 		s.Exec(v)
 	}
+	Unmonitor(s)
+}
+
+// Reopen 重新打开 Close 之后的服务，已注册的方法、优先级、溢出策略及执行统计保留
+// 用于模块重启后继续使用同一个服务，调用时其它协程不能使用服务
+func (s *Server) Reopen() {
+	s.ChanCall = make(chan *CallInfo, cap(s.ChanCall))
+	s.ChanCallHigh = make(chan *CallInfo, cap(s.ChanCallHigh))
 }
 
-// Go 异步处理
+// Go 异步处理，队列已满时按溢出策略处理
+// 方法未注册或者服务已经关闭时记录错误日志，并计入 GoFails
+// 溢出策略丢弃或者拒绝的调用只计入 OverflowCount，不记录日志，防止过载时日志刷屏
 // 线程安全
 func (s *Server) Go(id interface{}, args ...interface{}) {
-	f := s.functions[id]
+	f := s.function(id)
 	if f == nil {
+		s.goFailed(id, ErrNotRegistered)
 		return
 	}
 
-	defer func() {
-		recover()
-	}()
+	if err := s.enqueue(&CallInfo{
+		id:   id,
+		f:    f,
+		args: args,
+	}, true); err != nil {
+		s.goFailed(id, err)
+	}
+}
 
-	s.ChanCall <- &CallInfo{
+// GoContext 带上下文的异步处理，上下文用于传递优先级、链路追踪等信息
+// 线程安全
+func (s *Server) GoContext(ctx context.Context, id interface{}, args ...interface{}) {
+	f := s.function(id)
+	if f == nil {
+		s.goFailed(id, ErrNotRegistered)
+		return
+	}
+
+	if err := s.enqueue(&CallInfo{
+		id:   id,
 		f:    f,
 		args: args,
+		ctx:  ctx,
+		span: trace.FromContext(ctx),
+	}, true); err != nil {
+		s.goFailed(id, err)
 	}
 }
 
+// TryGo 异步处理，不阻塞调用方
+// 队列已满时按溢出策略处理，阻塞的策略直接返回 ErrQueueFull
+// 方法未注册、调用被丢弃或者服务已经关闭时返回错误，由调用方处理，不计入 Go 的失败次数
+// 线程安全
+func (s *Server) TryGo(id interface{}, args ...interface{}) error {
+	f := s.function(id)
+	if f == nil {
+		return fmt.Errorf("function id %v: %w", id, ErrNotRegistered)
+	}
+
+	return s.enqueue(&CallInfo{
+		id:   id,
+		f:    f,
+		args: args,
+	}, false)
+}
+
+func (s *Server) goFailed(id interface{}, err error) {
+	// 溢出策略有意丢弃或者拒绝的调用已经计入 OverflowCount
+	if errors.Is(err, ErrDropped) || errors.Is(err, ErrQueueFull) {
+		return
+	}
+	atomic.AddUint64(&s.goFails, 1)
+	log.Error("go function id %v: %v", id, err)
+}
+
 func (s *Server) Call0(id interface{}, args ...interface{}) error {
 	return s.Open(0).Call0(id, args...)
 }
@@ -165,6 +341,18 @@ func (s *Server) CallN(id interface{}, args ...interface{}) ([]interface{}, erro
 	return s.Open(0).CallN(id, args...)
 }
 
+func (s *Server) Call0Context(ctx context.Context, id interface{}, args ...interface{}) error {
+	return s.Open(0).Call0Context(ctx, id, args...)
+}
+
+func (s *Server) Call1Context(ctx context.Context, id interface{}, args ...interface{}) (interface{}, error) {
+	return s.Open(0).Call1Context(ctx, id, args...)
+}
+
+func (s *Server) CallNContext(ctx context.Context, id interface{}, args ...interface{}) ([]interface{}, error) {
+	return s.Open(0).CallNContext(ctx, id, args...)
+}
+
 // 创建客户端
 func (s *Server) Open(l int) *Client {
 	c := NewClient(l)
@@ -177,7 +365,8 @@ type Client struct {
 	s            *Server       // 服务端
 	ChanSyncRet  chan *RetInfo // 同步接收通道
 	ChanAsyncRet chan *RetInfo // 异步接收通道
-	pendingAsync int           // 待处理异步消息数量
+	pendingAsync int64         // 待处理异步消息数量
+	notify       func()        // 异步调用结果送达后的通知
 }
 
 func NewClient(l int) *Client {
@@ -191,14 +380,29 @@ func (c *Client) Attach(s *Server) {
 	c.s = s
 }
 
+// SetNotify 设置异步调用结果送达 ChanAsyncRet 后的通知方法，用于把客户端调度到协程池上执行
+// f 在服务端或者调用方协程中执行，必须线程安全且不能阻塞
+// 需要在客户端使用前设置
+func (c *Client) SetNotify(f func()) {
+	c.notify = f
+}
+
+// 异步调用的结果送达接收通道
+func (c *Client) asyncRet(ri *RetInfo) {
+	c.ChanAsyncRet <- ri
+	if c.notify != nil {
+		c.notify()
+	}
+}
+
 func (c *Client) f(id interface{}, n int) (f interface{}, err error) {
 	if c.s == nil {
-		err = errors.New("server not attached")
+		err = ErrNotAttached
 		return
 	}
-	f = c.s.functions[id]
+	f = c.s.function(id)
 	if f == nil {
-		err = fmt.Errorf("function id %v: function not registered", id)
+		err = fmt.Errorf("function id %v: %w", id, ErrNotRegistered)
 		return
 	}
 	var ok bool
@@ -213,29 +417,14 @@ func (c *Client) f(id interface{}, n int) (f interface{}, err error) {
 		panic("bug")
 	}
 	if !ok {
-		err = fmt.Errorf("function id %v: return type mismatch", id)
+		err = fmt.Errorf("function id %v: %w", id, ErrTypeMismatch)
 	}
 	return
 }
 
-// block 服务端如果队列已满，是否阻塞
-func (c *Client) call(ci *CallInfo, block bool) (err error) {
-	defer func() {
-		if r := recover(); r != nil {
-			err = r.(error)
-		}
-	}()
-
-	if block {
-		c.s.ChanCall <- ci
-		return
-	}
-	select {
-	case c.s.ChanCall <- ci:
-	default:
-		err = errors.New("channel rpc server channel full")
-	}
-	return
+// block 服务端如果队列已满，是否允许阻塞
+func (c *Client) call(ci *CallInfo, block bool) error {
+	return c.s.enqueue(ci, block)
 }
 
 /*
@@ -249,6 +438,7 @@ func (c *Client) Call0(id interface{}, args ...interface{}) error {
 	}
 
 	err = c.call(&CallInfo{
+		id:      id,
 		f:       f,
 		args:    args,
 		chanRet: c.ChanSyncRet,
@@ -268,6 +458,7 @@ func (c *Client) Call1(id interface{}, args ...interface{}) (interface{}, error)
 	}
 
 	err = c.call(&CallInfo{
+		id:      id,
 		f:       f,
 		args:    args,
 		chanRet: c.ChanSyncRet,
@@ -287,6 +478,7 @@ func (c *Client) CallN(id interface{}, args ...interface{}) ([]interface{}, erro
 	}
 
 	err = c.call(&CallInfo{
+		id:      id,
 		f:       f,
 		args:    args,
 		chanRet: c.ChanSyncRet,
@@ -299,27 +491,86 @@ func (c *Client) CallN(id interface{}, args ...interface{}) ([]interface{}, erro
 	return assert(ri.ret), ri.err
 }
 
+/*
+ 带上下文的同步调用: Call0Context Call1Context CallNContext
+ 上下文超时或者取消时立即返回错误，服务端尚未执行的调用不再执行，迟到的结果被丢弃
+ 线程安全
+*/
+func (c *Client) callContext(ctx context.Context, id interface{}, args []interface{}, n int) (interface{}, error) {
+	f, err := c.f(id, n)
+	if err != nil {
+		return nil, err
+	}
+
+	// 每次调用使用独立的接收通道，迟到的结果不会被后续调用读到
+	ci := &CallInfo{
+		id:      id,
+		f:       f,
+		args:    args,
+		chanRet: make(chan *RetInfo, 1),
+		ctx:     ctx,
+		span:    trace.FromContext(ctx),
+	}
+	err = c.call(ci, true)
+	if err != nil {
+		return nil, err
+	}
+
+	select {
+	case ri := <-ci.chanRet:
+		return ri.ret, ri.err
+	case <-ctx.Done():
+		return nil, ctxErr(ctx)
+	}
+}
+
+func (c *Client) Call0Context(ctx context.Context, id interface{}, args ...interface{}) error {
+	_, err := c.callContext(ctx, id, args, 0)
+	return err
+}
+
+func (c *Client) Call1Context(ctx context.Context, id interface{}, args ...interface{}) (interface{}, error) {
+	return c.callContext(ctx, id, args, 1)
+}
+
+func (c *Client) CallNContext(ctx context.Context, id interface{}, args ...interface{}) ([]interface{}, error) {
+	ret, err := c.callContext(ctx, id, args, 2)
+	return assert(ret), err
+}
+
 func (c *Client) asyncCall(id interface{}, args []interface{}, cb interface{}, n int) {
 	f, err := c.f(id, n)
 	if err != nil {
-		c.ChanAsyncRet <- &RetInfo{err: err, cb: cb}
+		c.asyncRet(&RetInfo{err: err, cb: cb})
 		return
 	}
 
 	err = c.call(&CallInfo{
+		id:      id,
 		f:       f,
 		args:    args,
 		chanRet: c.ChanAsyncRet,
 		cb:      cb,
+		notify:  c.notify,
 	}, false)
 	if err != nil {
-		c.ChanAsyncRet <- &RetInfo{err: err, cb: cb}
+		c.asyncRet(&RetInfo{err: err, cb: cb})
 		return
 	}
 }
 
 // AsyncCall 异步回调
 func (c *Client) AsyncCall(id interface{}, args ...interface{}) {
+	c.asyncCallCb(nil, id, args)
+}
+
+// AsyncCallContext 带上下文的异步回调
+// 上下文超时或者取消时回调收到错误，迟到的结果被丢弃，回调仍在客户端所在协程中执行
+func (c *Client) AsyncCallContext(ctx context.Context, id interface{}, args ...interface{}) {
+	c.asyncCallCb(ctx, id, args)
+}
+
+func (c *Client) asyncCallCb(ctx context.Context, id interface{}, args []interface{}) {
 	if len(args) < 1 {
 		panic("callback function not found")
 	}
@@ -337,13 +588,51 @@ func (c *Client) AsyncCall(id interface{}, args ...interface{}) {
 		panic("definition of callback function is invalid")
 	}
 	// 如果异步返回队列已满，直接返回错误信息，防止服务端阻塞
-	if c.pendingAsync >= cap(c.ChanAsyncRet) {
-		execCb(&RetInfo{err: errors.New("too many calls"), cb: cb})
+	if atomic.LoadInt64(&c.pendingAsync) >= int64(cap(c.ChanAsyncRet)) {
+		execCb(&RetInfo{err: ErrTooManyCalls, cb: cb})
 		return
 	}
 
-	c.asyncCall(id, args[:len(args)-1], cb, n)
-	c.pendingAsync++
+	if ctx == nil {
+		c.asyncCall(id, args[:len(args)-1], cb, n)
+	} else {
+		c.asyncCallContext(ctx, id, args[:len(args)-1], cb, n)
+	}
+	atomic.AddInt64(&c.pendingAsync, 1)
+}
+
+func (c *Client) asyncCallContext(ctx context.Context, id interface{}, args []interface{}, cb interface{}, n int) {
+	f, err := c.f(id, n)
+	if err == nil {
+		err = ctxErr(ctx)
+	}
+	if err != nil {
+		c.asyncRet(&RetInfo{err: err, cb: cb})
+		return
+	}
+
+	ci := &CallInfo{
+		id:      id,
+		f:       f,
+		args:    args,
+		chanRet: c.ChanAsyncRet,
+		cb:      cb,
+		ctx:     ctx,
+		span:    trace.FromContext(ctx),
+		notify:  c.notify,
+	}
+	// 超时或者取消时先于结果送达错误，每个调用只送达一次，不会超出 ChanAsyncRet 的容量
+	ci.stop = context.AfterFunc(ctx, func() {
+		if atomic.CompareAndSwapInt32(&ci.done, 0, 1) {
+			c.asyncRet(&RetInfo{err: ctxErr(ctx), cb: cb, span: ci.span})
+		}
+	})
+
+	err = c.call(ci, false)
+	if err != nil && atomic.CompareAndSwapInt32(&ci.done, 0, 1) {
+		ci.stop()
+		c.asyncRet(&RetInfo{err: err, cb: cb, span: ci.span})
+	}
 }
 
 func execCb(ri *RetInfo) {
@@ -374,18 +663,24 @@ func execCb(ri *RetInfo) {
 
 // Cb 回调处理
 func (c *Client) Cb(ri *RetInfo) {
-	c.pendingAsync--
+	atomic.AddInt64(&c.pendingAsync, -1)
 	execCb(ri)
 }
 
 // Close 等待所有异步调用执行后，关闭客户端
 func (c *Client) Close() {
-	for c.pendingAsync > 0 {
+	for atomic.LoadInt64(&c.pendingAsync) > 0 {
 		c.Cb(<-c.ChanAsyncRet)
 	}
 }
 
 // Idle 是否空闲
 func (c *Client) Idle() bool {
-	return c.pendingAsync == 0
+	return atomic.LoadInt64(&c.pendingAsync) == 0
+}
+
+// Pending 待处理的异步调用数量
+// 线程安全
+func (c *Client) Pending() int {
+	return int(atomic.LoadInt64(&c.pendingAsync))
 }
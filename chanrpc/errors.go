@@ -0,0 +1,44 @@
+package chanrpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// 调用返回的错误，使用 errors.Is 判断
+var (
+	ErrQueueFull     = errors.New("channel rpc server channel full")
+	ErrDropped       = fmt.Errorf("%w: call dropped", ErrQueueFull)         // 溢出策略丢弃了调用
+	ErrTooManyCalls  = fmt.Errorf("%w: too many async calls", ErrQueueFull) // 客户端异步返回队列已满
+	ErrNotRegistered = errors.New("function not registered")
+	ErrTypeMismatch  = errors.New("type mismatch") // 参数或者返回值的类型不符
+	ErrNotAttached   = errors.New("server not attached")
+	ErrServerClosed  = errors.New("channel rpc server closed")
+	ErrTimeout       = errors.New("channel rpc call timeout")
+)
+
+// PanicError 方法执行抛出的异常，使用 errors.As 获取
+type PanicError struct {
+	Value interface{} // recover 得到的值
+	Stack []byte      // 抛异常时的堆栈，conf.LenStackBuf 为 0 时为空
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprint(e.Value)
+}
+
+// Unwrap 异常值本身是 error 时返回它
+func (e *PanicError) Unwrap() error {
+	err, _ := e.Value.(error)
+	return err
+}
+
+// 上下文的错误，超时同时满足 errors.Is(err, ErrTimeout) 和 errors.Is(err, context.DeadlineExceeded)
+func ctxErr(ctx context.Context) error {
+	err := ctx.Err()
+	if errors.Is(err, context.DeadlineExceeded) {
+		return fmt.Errorf("%w: %w", ErrTimeout, err)
+	}
+	return err
+}
@@ -1,8 +1,11 @@
 package chanrpc_test
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"sync"
+	"time"
 
 	"github.com/skeletongo/leaf.v1/chanrpc"
 )
@@ -126,3 +129,245 @@ func Example() {
 	// 1 2 3
 	// 3
 }
+
+type addReq struct {
+	N1, N2 int
+}
+
+func ExampleRegister() {
+	s := chanrpc.NewServer(10)
+
+	chanrpc.Register(s, "add", func(req *addReq) int {
+		return req.N1 + req.N2
+	})
+
+	go func() {
+		for {
+			s.Exec(<-s.ChanCall)
+		}
+	}()
+
+	c := s.Open(10)
+
+	sum, err := chanrpc.Call[*addReq, int](c, "add", &addReq{N1: 1, N2: 2})
+	if err != nil {
+		fmt.Println(err)
+	} else {
+		fmt.Println(sum)
+	}
+
+	// 与无类型接口互通
+	ret, err := c.Call1("add", &addReq{N1: 3, N2: 4})
+	if err != nil {
+		fmt.Println(err)
+	} else {
+		fmt.Println(ret)
+	}
+
+	chanrpc.AsyncCall(c, "add", &addReq{N1: 5, N2: 6}, func(sum int, err error) {
+		if err != nil {
+			fmt.Println(err)
+		} else {
+			fmt.Println(sum)
+		}
+	})
+	c.Cb(<-c.ChanAsyncRet)
+
+	_, err = chanrpc.Call[*addReq, string](c, "add", &addReq{})
+	fmt.Println(err)
+
+	// Output:
+	// 3
+	// 7
+	// 11
+	// function id add: return type mismatch, want string, got int
+}
+
+func ExampleClient_Call1Context() {
+	s := chanrpc.NewServer(10)
+
+	s.Register("slow", func(args []interface{}) interface{} {
+		time.Sleep(100 * time.Millisecond)
+		return 1
+	})
+
+	go func() {
+		for {
+			s.Exec(<-s.ChanCall)
+		}
+	}()
+
+	c := s.Open(10)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := c.Call1Context(ctx, "slow")
+	fmt.Println(err)
+
+	// 迟到的结果被丢弃，不影响后续调用
+	ret, err := c.Call1("slow")
+	fmt.Println(ret, err)
+
+	// Output:
+	// channel rpc call timeout: context deadline exceeded
+	// 1 <nil>
+}
+
+func ExampleServer_SetOverflowPolicy() {
+	s := chanrpc.NewServer(1)
+	s.SetOverflowPolicy(chanrpc.OverflowDropOldest, 0)
+
+	s.Register("f", func(args []interface{}) {
+		fmt.Println(args[0])
+	})
+
+	// 队列长度为 1，后到的调用挤掉先到的调用
+	s.Go("f", 1)
+	s.Go("f", 2)
+	s.Go("f", 3)
+	s.Exec(<-s.ChanCall)
+
+	fmt.Println(s.OverflowCount().Dropped)
+
+	// Output:
+	// 3
+	// 2
+}
+
+func ExampleServer_Stats() {
+	s := chanrpc.NewServer(10)
+
+	s.Register("f", func(args []interface{}) {})
+	s.Register("panic", func(args []interface{}) {
+		panic("bug")
+	})
+
+	s.Go("f")
+	s.Go("f")
+	s.Go("panic")
+	fmt.Println(s.Stats().QueueLen)
+
+	for i := 0; i < 3; i++ {
+		s.Exec(<-s.ChanCall)
+	}
+
+	ss := s.Stats()
+	fmt.Println(ss.QueueLen, ss.Calls, ss.Panics)
+
+	// Output:
+	// 3
+	// 0 3 1
+}
+
+func ExampleServer_Replace() {
+	s := chanrpc.NewServer(10)
+
+	s.Register("version", func(args []interface{}) interface{} {
+		return 1
+	})
+
+	go func() {
+		for {
+			s.Exec(<-s.ChanCall)
+		}
+	}()
+
+	fmt.Println(s.Call1("version"))
+
+	s.Replace("version", func(args []interface{}) interface{} {
+		return 2
+	})
+	fmt.Println(s.Call1("version"))
+
+	s.Unregister("version")
+	fmt.Println(s.Call1("version"))
+
+	// Output:
+	// 1 <nil>
+	// 2 <nil>
+	// <nil> function id version: function not registered
+}
+
+func ExampleBus() {
+	bus := chanrpc.NewBus()
+	chat := chanrpc.NewServer(10)
+	mail := chanrpc.NewServer(10)
+
+	bus.Subscribe("PlayerLogin", chat, func(args []interface{}) interface{} {
+		return "chat: welcome " + args[0].(string)
+	})
+	bus.Subscribe("PlayerLogin", mail, func(args []interface{}) interface{} {
+		return "mail: 3 unread"
+	})
+
+	for _, s := range []*chanrpc.Server{chat, mail} {
+		go func(s *chanrpc.Server) {
+			for {
+				s.Exec(<-s.ChanCall)
+			}
+		}(s)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	for _, r := range bus.Call(ctx, "PlayerLogin", "leaf") {
+		fmt.Println(r.Ret, r.Err)
+	}
+
+	// Output:
+	// chat: welcome leaf <nil>
+	// mail: 3 unread <nil>
+}
+
+func ExampleServer_SetPriority() {
+	s := chanrpc.NewServer(10)
+
+	s.Register("move", func(args []interface{}) {
+		fmt.Println("move")
+	})
+	s.Register("kick", func(args []interface{}) {
+		fmt.Println("kick")
+	})
+	s.SetPriority("kick", chanrpc.PriorityHigh)
+
+	s.Go("move")
+	s.Go("move")
+	s.Go("kick")
+
+	// 先处理高优先级队列
+	s.Close()
+
+	// Output:
+	// kick
+	// move
+	// move
+}
+
+func ExamplePanicError() {
+	s := chanrpc.NewServer(10)
+
+	s.Register("panic", func(args []interface{}) {
+		panic("oops")
+	})
+
+	go func() {
+		for {
+			s.Exec(<-s.ChanCall)
+		}
+	}()
+
+	c := s.Open(10)
+
+	err := c.Call0("panic")
+	var pe *chanrpc.PanicError
+	if errors.As(err, &pe) {
+		fmt.Println(pe.Value)
+	}
+
+	err = c.Call0("none")
+	fmt.Println(errors.Is(err, chanrpc.ErrNotRegistered))
+
+	// Output:
+	// oops
+	// true
+}
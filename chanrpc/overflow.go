@@ -0,0 +1,126 @@
+package chanrpc
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// OverflowPolicy 待处理消息队列已满时的处理策略
+type OverflowPolicy int
+
+const (
+	OverflowBlock        OverflowPolicy = iota // 阻塞直到队列有空位，异步调用直接返回错误(默认)
+	OverflowBlockTimeout                       // 阻塞直到队列有空位或者超时，异步调用直接返回错误
+	OverflowDropNewest                         // 丢弃新的调用
+	OverflowDropOldest                         // 丢弃队列中最早的调用，为新的调用腾出空位
+	OverflowReject                             // 拒绝新的调用并返回错误
+)
+
+// OverflowCount 队列溢出计数
+type OverflowCount struct {
+	Dropped  uint64 // 丢弃的调用数量
+	Rejected uint64 // 拒绝的调用数量
+	Timeout  uint64 // 阻塞超时的调用数量
+}
+
+// SetOverflowPolicy 设置队列溢出策略，timeout 只用于 OverflowBlockTimeout
+// 需要在服务使用前设置
+func (s *Server) SetOverflowPolicy(policy OverflowPolicy, timeout time.Duration) {
+	if policy == OverflowBlockTimeout && timeout <= 0 {
+		panic("invalid overflow block timeout")
+	}
+	s.policy = policy
+	s.blockTimeout = timeout
+}
+
+// OverflowCount 队列溢出计数
+// 线程安全
+func (s *Server) OverflowCount() OverflowCount {
+	return OverflowCount{
+		Dropped:  atomic.LoadUint64(&s.dropped),
+		Rejected: atomic.LoadUint64(&s.rejected),
+		Timeout:  atomic.LoadUint64(&s.timeout),
+	}
+}
+
+// SetNotify 设置调用入队列后的通知方法，用于把服务调度到协程池上执行，而不是由固定的协程处理
+// f 在调用方协程中执行，必须线程安全且不能阻塞
+// 需要在服务使用前设置
+func (s *Server) SetNotify(f func()) {
+	s.notify = f
+}
+
+// 调用入队列
+// block 调用方是否允许阻塞，异步调用不能阻塞，防止互相调用的模块死锁
+func (s *Server) enqueue(ci *CallInfo, block bool) (err error) {
+	// 队列可能已经关闭
+	defer func() {
+		if r := recover(); r != nil {
+			err = ErrServerClosed
+			return
+		}
+		if err == nil && s.notify != nil {
+			s.notify()
+		}
+	}()
+
+	ch := s.lane(ci)
+	select {
+	case ch <- ci:
+		return
+	default:
+	}
+
+	var done <-chan struct{}
+	if ci.ctx != nil {
+		done = ci.ctx.Done()
+	}
+
+	switch s.policy {
+	case OverflowBlock:
+		if !block {
+			break
+		}
+		select {
+		case ch <- ci:
+		case <-done:
+			err = ctxErr(ci.ctx)
+		}
+		return
+	case OverflowBlockTimeout:
+		if !block {
+			break
+		}
+		t := time.NewTimer(s.blockTimeout)
+		defer t.Stop()
+		select {
+		case ch <- ci:
+		case <-done:
+			err = ctxErr(ci.ctx)
+		case <-t.C:
+			atomic.AddUint64(&s.timeout, 1)
+			err = ErrQueueFull
+		}
+		return
+	case OverflowDropNewest:
+		atomic.AddUint64(&s.dropped, 1)
+		return ErrDropped
+	case OverflowDropOldest:
+		for {
+			select {
+			case ch <- ci:
+				return
+			default:
+			}
+			select {
+			case old := <-ch:
+				atomic.AddUint64(&s.dropped, 1)
+				_ = ret(old, &RetInfo{err: ErrDropped})
+			default:
+			}
+		}
+	}
+
+	atomic.AddUint64(&s.rejected, 1)
+	return ErrQueueFull
+}
@@ -0,0 +1,72 @@
+package chanrpc
+
+import (
+	"context"
+)
+
+// Priority 调用的优先级
+// 高优先级的调用进入 ChanCallHigh 队列，模块协程优先处理
+type Priority int
+
+const (
+	PriorityNormal Priority = iota
+	PriorityHigh
+)
+
+type priorityKey struct{}
+
+// WithPriority 为带上下文的调用指定优先级，例如 Call1Context、AsyncCallContext、Bus.Call
+func WithPriority(ctx context.Context, p Priority) context.Context {
+	return context.WithValue(ctx, priorityKey{}, p)
+}
+
+// SetPriority 设置方法的默认优先级，对该方法的所有调用生效
+// 线程安全
+func (s *Server) SetPriority(id interface{}, p Priority) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if p == PriorityNormal {
+		delete(s.priorities, id)
+		return
+	}
+	s.priorities[id] = p
+}
+
+// GoPriority 以指定的优先级异步处理，失败时的处理与 Go 相同
+// 线程安全
+func (s *Server) GoPriority(p Priority, id interface{}, args ...interface{}) {
+	f := s.function(id)
+	if f == nil {
+		s.goFailed(id, ErrNotRegistered)
+		return
+	}
+
+	if err := s.enqueue(&CallInfo{
+		id:       id,
+		f:        f,
+		args:     args,
+		priority: p,
+	}, true); err != nil {
+		s.goFailed(id, err)
+	}
+}
+
+// 调用进入的队列，取方法默认优先级、上下文优先级、调用指定优先级中最高的
+func (s *Server) lane(ci *CallInfo) chan *CallInfo {
+	p := ci.priority
+	if ci.ctx != nil {
+		if v, ok := ci.ctx.Value(priorityKey{}).(Priority); ok && v > p {
+			p = v
+		}
+	}
+	s.mu.RLock()
+	if v := s.priorities[ci.id]; v > p {
+		p = v
+	}
+	s.mu.RUnlock()
+
+	if p >= PriorityHigh {
+		return s.ChanCallHigh
+	}
+	return s.ChanCall
+}
@@ -0,0 +1,187 @@
+package chanrpc
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// HistogramBuckets 执行时间分布的区间上限，最后一个区间为超过最大上限的部分
+var HistogramBuckets = [...]time.Duration{
+	time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+}
+
+// 方法的执行统计，只由服务端协程写入，注销后重新注册的方法重新统计
+type funcStats struct {
+	calls     uint64
+	panics    uint64
+	totalTime int64
+	maxTime   int64
+	histogram [len(HistogramBuckets) + 1]uint64
+	sec       int64  // 当前统计的秒
+	secCalls  uint64 // 当前秒的执行次数
+	lastCalls uint64 // 上一秒的执行次数
+}
+
+// FuncStats 方法的执行统计
+type FuncStats struct {
+	ID        interface{}
+	Calls     uint64        // 执行次数
+	Panics    uint64        // 抛异常的次数
+	Rate      uint64        // 最近一秒的执行次数
+	TotalTime time.Duration // 总执行时间
+	MaxTime   time.Duration // 最长执行时间
+	Histogram [len(HistogramBuckets) + 1]uint64
+}
+
+// ServerStats 服务端的执行统计
+type ServerStats struct {
+	Name         string
+	QueueLen     int // 队列中待处理的调用数量
+	QueueCap     int
+	PendingAsync int // 关联客户端待处理的异步调用数量
+	Calls        uint64
+	Panics       uint64
+	Rate         uint64
+	Overflow     OverflowCount
+	GoFails      uint64      // Go、GoContext、GoPriority 失败的次数，不含溢出策略丢弃或者拒绝的调用
+	Funcs        []FuncStats // 按总执行时间从大到小排列
+}
+
+func (s *Server) record(id interface{}, d time.Duration, panicked bool) {
+	s.mu.RLock()
+	fs := s.stats[id]
+	s.mu.RUnlock()
+	if fs == nil {
+		return
+	}
+
+	atomic.AddUint64(&fs.calls, 1)
+	if panicked {
+		atomic.AddUint64(&fs.panics, 1)
+	}
+	atomic.AddInt64(&fs.totalTime, int64(d))
+	if int64(d) > atomic.LoadInt64(&fs.maxTime) {
+		atomic.StoreInt64(&fs.maxTime, int64(d))
+	}
+	i := 0
+	for i < len(HistogramBuckets) && d > HistogramBuckets[i] {
+		i++
+	}
+	atomic.AddUint64(&fs.histogram[i], 1)
+
+	sec := time.Now().Unix()
+	switch atomic.LoadInt64(&fs.sec) {
+	case sec:
+	case sec - 1:
+		atomic.StoreUint64(&fs.lastCalls, atomic.SwapUint64(&fs.secCalls, 0))
+		atomic.StoreInt64(&fs.sec, sec)
+	default:
+		atomic.StoreUint64(&fs.lastCalls, 0)
+		atomic.StoreUint64(&fs.secCalls, 0)
+		atomic.StoreInt64(&fs.sec, sec)
+	}
+	atomic.AddUint64(&fs.secCalls, 1)
+}
+
+func (fs *funcStats) rate() uint64 {
+	switch atomic.LoadInt64(&fs.sec) {
+	case time.Now().Unix():
+		return atomic.LoadUint64(&fs.lastCalls)
+	case time.Now().Unix() - 1:
+		return atomic.LoadUint64(&fs.secCalls)
+	}
+	return 0
+}
+
+// Stats 执行统计
+// 线程安全
+func (s *Server) Stats() *ServerStats {
+	ss := &ServerStats{
+		QueueLen: len(s.ChanCall) + len(s.ChanCallHigh),
+		QueueCap: cap(s.ChanCall) + cap(s.ChanCallHigh),
+		Overflow: s.OverflowCount(),
+		GoFails:  atomic.LoadUint64(&s.goFails),
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for id, fs := range s.stats {
+		f := FuncStats{
+			ID:        id,
+			Calls:     atomic.LoadUint64(&fs.calls),
+			Panics:    atomic.LoadUint64(&fs.panics),
+			Rate:      fs.rate(),
+			TotalTime: time.Duration(atomic.LoadInt64(&fs.totalTime)),
+			MaxTime:   time.Duration(atomic.LoadInt64(&fs.maxTime)),
+		}
+		for i := range fs.histogram {
+			f.Histogram[i] = atomic.LoadUint64(&fs.histogram[i])
+		}
+		ss.Calls += f.Calls
+		ss.Panics += f.Panics
+		ss.Rate += f.Rate
+		ss.Funcs = append(ss.Funcs, f)
+	}
+	sort.Slice(ss.Funcs, func(i, j int) bool {
+		return ss.Funcs[i].TotalTime > ss.Funcs[j].TotalTime
+	})
+	return ss
+}
+
+type monitor struct {
+	name   string
+	server *Server
+	client *Client
+}
+
+var (
+	muMonitors sync.Mutex
+	monitors   []*monitor
+)
+
+// Monitor 按名字登记服务端及调用它的客户端，用于统计查询，client 可以为 nil
+// 线程安全
+func Monitor(name string, server *Server, client *Client) {
+	muMonitors.Lock()
+	defer muMonitors.Unlock()
+	monitors = append(monitors, &monitor{name: name, server: server, client: client})
+}
+
+// Unmonitor 取消登记，服务端关闭时自动取消
+// 线程安全
+func Unmonitor(server *Server) {
+	muMonitors.Lock()
+	defer muMonitors.Unlock()
+	for i, m := range monitors {
+		if m.server == server {
+			monitors = append(monitors[:i], monitors[i+1:]...)
+			return
+		}
+	}
+}
+
+// AllStats 所有登记的服务端的执行统计，按登记顺序排列
+// 线程安全
+func AllStats() []*ServerStats {
+	muMonitors.Lock()
+	ms := append([]*monitor(nil), monitors...)
+	muMonitors.Unlock()
+
+	var all []*ServerStats
+	for _, m := range ms {
+		ss := m.server.Stats()
+		ss.Name = m.name
+		if m.client != nil {
+			ss.PendingAsync = m.client.Pending()
+		}
+		all = append(all, ss)
+	}
+	return all
+}
@@ -0,0 +1,113 @@
+package chanrpc
+
+import (
+	"context"
+	"fmt"
+)
+
+/*
+ 类型安全的接口
+ 基于 Server/Client 实现，参数和返回值在编译期检查类型
+ 注册的方法同样可以通过无类型的接口调用，此时参数为一个 Req，返回值为 Resp
+*/
+
+// 参数不符时抛出包装了 ErrTypeMismatch 的错误，调用方收到的 PanicError 可以用 errors.Is 判断
+func arg[Req any](id interface{}, args []interface{}) Req {
+	if len(args) != 1 {
+		panic(fmt.Errorf("function id %v: %w, want 1 argument, got %v", id, ErrTypeMismatch, len(args)))
+	}
+	req, ok := args[0].(Req)
+	if !ok && args[0] != nil {
+		panic(fmt.Errorf("function id %v: argument %w, want %T, got %T", id, ErrTypeMismatch, req, args[0]))
+	}
+	return req
+}
+
+// Register 注册有返回值的处理方法
+func Register[Req, Resp any](s *Server, id interface{}, f func(Req) Resp) {
+	s.Register(id, func(args []interface{}) interface{} {
+		return f(arg[Req](id, args))
+	})
+}
+
+// Register0 注册无返回值的处理方法
+func Register0[Req any](s *Server, id interface{}, f func(Req)) {
+	s.Register(id, func(args []interface{}) {
+		f(arg[Req](id, args))
+	})
+}
+
+// Replace 替换有返回值的处理方法，未注册时直接注册
+func Replace[Req, Resp any](s *Server, id interface{}, f func(Req) Resp) {
+	s.Replace(id, func(args []interface{}) interface{} {
+		return f(arg[Req](id, args))
+	})
+}
+
+// Replace0 替换无返回值的处理方法，未注册时直接注册
+func Replace0[Req any](s *Server, id interface{}, f func(Req)) {
+	s.Replace(id, func(args []interface{}) {
+		f(arg[Req](id, args))
+	})
+}
+
+func result[Resp any](id interface{}, ret interface{}) (Resp, error) {
+	var resp Resp
+	if ret == nil {
+		return resp, nil
+	}
+	resp, ok := ret.(Resp)
+	if !ok {
+		return resp, fmt.Errorf("function id %v: return %w, want %T, got %T", id, ErrTypeMismatch, resp, ret)
+	}
+	return resp, nil
+}
+
+// Call 同步调用有返回值的方法
+// 线程安全
+func Call[Req, Resp any](c *Client, id interface{}, req Req) (Resp, error) {
+	ret, err := c.Call1(id, req)
+	if err != nil {
+		var resp Resp
+		return resp, err
+	}
+	return result[Resp](id, ret)
+}
+
+// Call0 同步调用无返回值的方法
+// 线程安全
+func Call0[Req any](c *Client, id interface{}, req Req) error {
+	return c.Call0(id, req)
+}
+
+// AsyncCall 异步调用有返回值的方法，回调在客户端所在协程中执行
+func AsyncCall[Req, Resp any](c *Client, id interface{}, req Req, cb func(Resp, error)) {
+	c.AsyncCall(id, req, callback(id, cb))
+}
+
+// AsyncCallContext 带上下文的异步调用有返回值的方法，回调在客户端所在协程中执行
+func AsyncCallContext[Req, Resp any](ctx context.Context, c *Client, id interface{}, req Req, cb func(Resp, error)) {
+	c.AsyncCallContext(ctx, id, req, callback(id, cb))
+}
+
+func callback[Resp any](id interface{}, cb func(Resp, error)) func(interface{}, error) {
+	return func(ret interface{}, err error) {
+		if err != nil {
+			var resp Resp
+			cb(resp, err)
+			return
+		}
+		cb(result[Resp](id, ret))
+	}
+}
+
+// AsyncCall0 异步调用无返回值的方法，回调在客户端所在协程中执行
+func AsyncCall0[Req any](c *Client, id interface{}, req Req, cb func(error)) {
+	c.AsyncCall(id, req, cb)
+}
+
+// Go 异步处理，不关心结果
+// 线程安全
+func Go[Req any](s *Server, id interface{}, req Req) {
+	s.Go(id, req)
+}
@@ -8,45 +8,68 @@ import (
 	"github.com/skeletongo/leaf.v1/network"
 )
 
-var (
+// Cluster 集群服务，监听其它节点的连接并连接到其它节点
+type Cluster struct {
+	ListenAddr      string   // 监听地址，为空时不监听
+	ConnAddrs       []string // 连接的节点地址
+	PendingWriteNum int
+
 	server  *network.TCPServer
 	clients []*network.TCPClient
-)
+}
+
+var std *Cluster
 
+// Init 按 conf 中的配置启动集群服务
 func Init() {
-	if conf.ListenAddr != "" {
-		server = new(network.TCPServer)
-		server.Addr = conf.ListenAddr
-		server.MaxConnNum = int(math.MaxInt32)
-		server.PendingWriteNum = conf.PendingWriteNum
-		server.ByteLen = 4
-		server.MaxPkgLen = math.MaxUint32
-		server.NewAgent = newAgent
-
-		server.Start()
+	std = &Cluster{
+		ListenAddr:      conf.ListenAddr,
+		ConnAddrs:       conf.ConnAddrs,
+		PendingWriteNum: conf.PendingWriteNum,
 	}
+	std.Start()
+}
 
-	for _, addr := range conf.ConnAddrs {
+func Destroy() {
+	if std != nil {
+		std.Close()
+	}
+}
+
+func (c *Cluster) Start() {
+	if c.ListenAddr != "" {
+		c.server = new(network.TCPServer)
+		c.server.Addr = c.ListenAddr
+		c.server.MaxConnNum = int(math.MaxInt32)
+		c.server.PendingWriteNum = c.PendingWriteNum
+		c.server.ByteLen = 4
+		c.server.MaxPkgLen = math.MaxUint32
+		c.server.NewAgent = newAgent
+
+		c.server.Start()
+	}
+
+	for _, addr := range c.ConnAddrs {
 		client := new(network.TCPClient)
 		client.Addr = addr
 		client.ConnNum = 1
 		client.ConnectInterval = 3 * time.Second
-		client.PendingWriteNum = conf.PendingWriteNum
+		client.PendingWriteNum = c.PendingWriteNum
 		client.ByteLen = 4
 		client.MaxPkgLen = math.MaxUint32
 		client.NewAgent = newAgent
 
 		client.Start()
-		clients = append(clients, client)
+		c.clients = append(c.clients, client)
 	}
 }
 
-func Destroy() {
-	if server != nil {
-		server.Close()
+func (c *Cluster) Close() {
+	if c.server != nil {
+		c.server.Close()
 	}
 
-	for _, client := range clients {
+	for _, client := range c.clients {
 		client.Close()
 	}
 }
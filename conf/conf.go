@@ -1,5 +1,7 @@
 package conf
 
+import "time"
+
 var (
 	LenStackBuf = 4096
 
@@ -17,4 +19,68 @@ var (
 	ListenAddr      string
 	ConnAddrs       []string
 	PendingWriteNum int
+
+	// shutdown
+	ModuleCloseTimeout time.Duration // 单个模块关闭的超时时间，为 0 时不限制
+	CloseTimeout       time.Duration // 所有模块关闭的总超时时间，为 0 时不限制
 )
+
+// Settings 框架的配置，leaf.Config 即此类型
+// 可以作为应用配置结构体的一部分由 Loader 加载，通过 Apply 写入全局配置或者用于创建 leaf.App
+// LenStackBuf、ProfilePath 只有全局配置，leaf.App 不使用
+type Settings struct {
+	LenStackBuf int
+
+	// log
+	LogLevel string
+	LogPath  string
+	LogFlag  int
+
+	// console
+	ConsolePort   int
+	ConsolePrompt string
+	ProfilePath   string
+
+	// cluster
+	ListenAddr      string
+	ConnAddrs       []string
+	PendingWriteNum int
+
+	// shutdown
+	ModuleCloseTimeout time.Duration
+	CloseTimeout       time.Duration
+}
+
+// Current 当前的全局配置
+func Current() Settings {
+	return Settings{
+		LenStackBuf:        LenStackBuf,
+		LogLevel:           LogLevel,
+		LogPath:            LogPath,
+		LogFlag:            LogFlag,
+		ConsolePort:        ConsolePort,
+		ConsolePrompt:      ConsolePrompt,
+		ProfilePath:        ProfilePath,
+		ListenAddr:         ListenAddr,
+		ConnAddrs:          ConnAddrs,
+		PendingWriteNum:    PendingWriteNum,
+		ModuleCloseTimeout: ModuleCloseTimeout,
+		CloseTimeout:       CloseTimeout,
+	}
+}
+
+// Apply 写入全局配置，需要在 leaf.Run 之前调用
+func (s *Settings) Apply() {
+	LenStackBuf = s.LenStackBuf
+	LogLevel = s.LogLevel
+	LogPath = s.LogPath
+	LogFlag = s.LogFlag
+	ConsolePort = s.ConsolePort
+	ConsolePrompt = s.ConsolePrompt
+	ProfilePath = s.ProfilePath
+	ListenAddr = s.ListenAddr
+	ConnAddrs = s.ConnAddrs
+	PendingWriteNum = s.PendingWriteNum
+	ModuleCloseTimeout = s.ModuleCloseTimeout
+	CloseTimeout = s.CloseTimeout
+}
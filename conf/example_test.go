@@ -0,0 +1,138 @@
+package conf_test
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/skeletongo/leaf.v1/conf"
+)
+
+type GameConfig struct {
+	Leaf conf.Settings
+	Game struct {
+		Name    string `required:"true"`
+		MaxRoom int    `default:"100"`
+		Debug   bool
+	}
+}
+
+func ExampleLoader() {
+	dir, _ := os.MkdirTemp("", "conf")
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "server.json")
+	os.WriteFile(file, []byte(`{"Leaf": {"ConsolePort": 3333}, "Game": {"Name": "demo"}}`), 0644)
+
+	os.Setenv("DEMO_LEAF_LOG_LEVEL", "release")
+	defer os.Unsetenv("DEMO_LEAF_LOG_LEVEL")
+
+	cfg := GameConfig{Leaf: conf.Current()}
+	l := &conf.Loader{
+		Files:     []string{file},
+		EnvPrefix: "DEMO_",
+		FlagSet:   flag.NewFlagSet("demo", flag.ContinueOnError),
+		Args:      []string{"-game.debug", "-game.max-room", "200"},
+	}
+	if err := l.Load(&cfg); err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Printf("%v %v %q\n", cfg.Leaf.ConsolePort, cfg.Leaf.LogLevel, cfg.Leaf.ConsolePrompt)
+	fmt.Println(cfg.Game.Name, cfg.Game.MaxRoom, cfg.Game.Debug)
+
+	cfg.Game.Name = ""
+	fmt.Println(conf.Load(&cfg.Game, "DEMO_"))
+
+	// Output:
+	// 3333 release "Leaf# "
+	// demo 200 true
+	// conf: Name is required
+}
+
+type ServerConfig struct {
+	Name    string
+	Timeout time.Duration
+	Tags    []string
+	Rooms   []struct {
+		ID   int
+		Name string
+	}
+	Limits map[string]int
+}
+
+func ExampleLoader_formats() {
+	dir, _ := os.MkdirTemp("", "conf")
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		"server.json": `{"name": "json", "timeout": "1m30s", "tags": ["a", "b"], "rooms": [{"id": 1, "name": "lobby"}], "limits": {"room": 10}}`,
+		"server.yaml": `
+# 注释
+name: "yaml" # 行尾注释
+timeout: 10s
+tags: [a, b]
+rooms:
+  - id: 1
+    name: lobby
+  - id: 2
+    name: 'it''s mine'
+limits:
+  room: 10
+`,
+		"server.toml": `
+name = "toml"
+timeout = "500ms"
+tags = [
+  "a",
+  "b",
+]
+limits = { room = 10 }
+
+[[rooms]]
+id = 1
+name = "lobby"
+`,
+	}
+	for _, name := range []string{"server.json", "server.yaml", "server.toml"} {
+		file := filepath.Join(dir, name)
+		os.WriteFile(file, []byte(files[name]), 0644)
+
+		var cfg ServerConfig
+		if err := conf.Load(&cfg, "DEMO_", file); err != nil {
+			fmt.Println(err)
+			continue
+		}
+		fmt.Println(cfg.Name, cfg.Timeout, cfg.Tags, cfg.Rooms, cfg.Limits)
+	}
+
+	// Output:
+	// json 1m30s [a b] [{1 lobby}] map[room:10]
+	// yaml 10s [a b] [{1 lobby} {2 it's mine}] map[room:10]
+	// toml 500ms [a b] [{1 lobby}] map[room:10]
+}
+
+func ExampleLoader_reload() {
+	// 同一个 Loader 可以多次加载，命令行参数每次都重新生效
+	l := &conf.Loader{
+		FlagSet: flag.NewFlagSet("demo", flag.ContinueOnError),
+		Args:    []string{"-timeout", "3s"},
+	}
+	for i := 0; i < 2; i++ {
+		var cfg ServerConfig
+		if err := l.Load(&cfg); err != nil {
+			fmt.Println(err)
+			continue
+		}
+		fmt.Println(cfg.Timeout)
+	}
+
+	// 参数已经由其它 Loader 定义
+	other := &conf.Loader{FlagSet: l.FlagSet, Args: []string{}}
+	fmt.Println(other.Load(&ServerConfig{}))
+
+	// Output:
+	// 3s
+	// 3s
+	// conf: flag name already defined
+}
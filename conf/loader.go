@@ -0,0 +1,432 @@
+package conf
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Decoder 配置文件解码方法，签名与 json.Unmarshal 相同
+// v 为 *interface{}，解码为 map[string]interface{}、[]interface{} 及标量组成的通用结构，再由 Loader 写入配置结构体
+type Decoder func(data []byte, v interface{}) error
+
+// 按文件扩展名选择解码方法
+// YAML 使用 gopkg.in/yaml.v3，TOML 使用 github.com/BurntSushi/toml
+var decoders = map[string]Decoder{
+	".json": decodeJSON,
+	".yaml": yaml.Unmarshal,
+	".yml":  yaml.Unmarshal,
+	".toml": toml.Unmarshal,
+}
+
+// RegisterDecoder 注册配置文件解码方法，ext 为文件扩展名，例如 ".ini"，也可以替换内置的解码方法
+// 需要在加载配置之前调用，非线程安全
+func RegisterDecoder(ext string, d Decoder) {
+	decoders[strings.ToLower(ext)] = d
+}
+
+// Validator 可选接口，配置加载完成后调用，返回错误时加载失败
+type Validator interface {
+	Validate() error
+}
+
+// Loader 配置加载器，依次应用：
+//  1. 字段标签 default:"..." 指定的默认值(只用于零值字段)
+//  2. Files 中的配置文件，后面的覆盖前面的，字段名按 json 标签或者不区分大小写的字段名匹配
+//  3. 环境变量，变量名为标签 env:"..." 指定的名字，或者 EnvPrefix 加上字段路径的大写下划线形式，例如 LEAF_CONSOLE_PORT
+//  4. 命令行参数，参数名为标签 flag:"..." 指定的名字，或者字段路径的小写连字符形式，例如 -leaf.console-port
+//
+// 最后检查标签为 required:"true" 的字段不能为零值，并调用 Validator
+// 支持的字段类型：string、bool、整数、浮点数、time.Duration、[]string(逗号分隔)及嵌套的结构体
+// time.Duration 在配置文件、环境变量和命令行参数中都可以写作 "10s" 等形式，配置文件中的数字为纳秒数
+// 配置文件中其它类型的字段按 encoding/json 的规则解码
+//
+// 同一个 Loader 可以多次加载(例如热加载)，命令行参数每次重新解析到新的配置中；
+// FlagSet 不能同时用于多个 Loader
+type Loader struct {
+	Files     []string
+	EnvPrefix string
+	FlagSet   *flag.FlagSet // 为 nil 时不解析命令行参数
+	Args      []string      // 命令行参数，为 nil 时使用 os.Args[1:]
+
+	flags map[string]*flagValue // 已经在 FlagSet 上定义的参数
+}
+
+// Load 加载配置到 v，v 必须是结构体指针
+func (l *Loader) Load(v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Struct {
+		return errors.New("conf: struct pointer required")
+	}
+	var fields []field
+	collect(rv.Elem(), nil, &fields)
+
+	for _, f := range fields {
+		if def, ok := f.tag.Lookup("default"); ok && f.v.IsZero() {
+			if err := setValue(f.v, def); err != nil {
+				return fmt.Errorf("conf: default of %v: %v", f.path(), err)
+			}
+		}
+	}
+
+	for _, file := range l.Files {
+		if err := decodeFile(file, v); err != nil {
+			return err
+		}
+	}
+
+	for _, f := range fields {
+		name := f.env(l.EnvPrefix)
+		if s, ok := os.LookupEnv(name); ok {
+			if err := setValue(f.v, s); err != nil {
+				return fmt.Errorf("conf: env %v: %v", name, err)
+			}
+		}
+	}
+
+	if l.FlagSet != nil {
+		if l.flags == nil {
+			l.flags = make(map[string]*flagValue)
+		}
+		for _, f := range fields {
+			name := f.flag()
+			// 再次加载时参数指向新的配置
+			if fv, ok := l.flags[name]; ok {
+				fv.v = f.v
+				continue
+			}
+			if l.FlagSet.Lookup(name) != nil {
+				return fmt.Errorf("conf: flag %v already defined", name)
+			}
+			fv := &flagValue{v: f.v}
+			l.FlagSet.Var(fv, name, "config "+f.path())
+			l.flags[name] = fv
+		}
+		args := l.Args
+		if args == nil {
+			args = os.Args[1:]
+		}
+		if err := l.FlagSet.Parse(args); err != nil {
+			return err
+		}
+	}
+
+	for _, f := range fields {
+		if f.tag.Get("required") == "true" && f.v.IsZero() {
+			return fmt.Errorf("conf: %v is required", f.path())
+		}
+	}
+	if validator, ok := v.(Validator); ok {
+		if err := validator.Validate(); err != nil {
+			return fmt.Errorf("conf: %v", err)
+		}
+	}
+	return nil
+}
+
+// Load 使用默认的加载器加载配置文件到 v，环境变量前缀为 envPrefix，不解析命令行参数
+func Load(v interface{}, envPrefix string, files ...string) error {
+	l := &Loader{Files: files, EnvPrefix: envPrefix}
+	return l.Load(v)
+}
+
+func decodeFile(file string, v interface{}) error {
+	d, ok := decoders[strings.ToLower(filepath.Ext(file))]
+	if !ok {
+		return fmt.Errorf("conf: no decoder for %v", file)
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return fmt.Errorf("conf: %v", err)
+	}
+	var x interface{}
+	if err := d(data, &x); err != nil {
+		return fmt.Errorf("conf: %v: %v", file, err)
+	}
+	if err := assign(reflect.ValueOf(v).Elem(), x); err != nil {
+		return fmt.Errorf("conf: %v: %v", file, err)
+	}
+	return nil
+}
+
+func decodeJSON(data []byte, v interface{}) error {
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+	return d.Decode(v)
+}
+
+// 把解码得到的通用结构写入 v
+func assign(v reflect.Value, x interface{}) error {
+	if x == nil {
+		return nil
+	}
+	if m, ok := x.(map[interface{}]interface{}); ok {
+		sm := make(map[string]interface{}, len(m))
+		for k, e := range m {
+			sm[fmt.Sprint(k)] = e
+		}
+		x = sm
+	}
+
+	switch {
+	case v.Type() == durationType:
+		switch n := x.(type) {
+		case string:
+			return setValue(v, n)
+		case json.Number:
+			d, err := n.Int64()
+			if err != nil {
+				return err
+			}
+			v.SetInt(d)
+			return nil
+		case int:
+			v.SetInt(int64(n))
+			return nil
+		case int64:
+			v.SetInt(n)
+			return nil
+		}
+	case v.Kind() == reflect.Ptr:
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return assign(v.Elem(), x)
+	case v.Kind() == reflect.Struct:
+		if m, ok := x.(map[string]interface{}); ok {
+			return assignStruct(v, m)
+		}
+	case settable(v.Type()):
+		switch s := x.(type) {
+		case string:
+			return setValue(v, s)
+		}
+		if v.Kind() == reflect.Slice {
+			break
+		}
+		switch s := x.(type) {
+		case json.Number:
+			return setValue(v, s.String())
+		case bool:
+			return setValue(v, strconv.FormatBool(s))
+		case int:
+			return setValue(v, strconv.Itoa(s))
+		case int64:
+			return setValue(v, strconv.FormatInt(s, 10))
+		case float64:
+			return setValue(v, strconv.FormatFloat(s, 'f', -1, 64))
+		}
+	}
+
+	data, err := json.Marshal(x)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v.Addr().Interface())
+}
+
+// 字段名按 json 标签或者不区分大小写的字段名匹配，匿名结构体字段展开
+func assignStruct(v reflect.Value, m map[string]interface{}) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.PkgPath != "" {
+			continue
+		}
+		name := strings.Split(sf.Tag.Get("json"), ",")[0]
+		if name == "-" {
+			continue
+		}
+		if name == "" && sf.Anonymous && sf.Type.Kind() == reflect.Struct {
+			if err := assignStruct(v.Field(i), m); err != nil {
+				return err
+			}
+			continue
+		}
+		if name == "" {
+			name = sf.Name
+		}
+
+		x, ok := m[name]
+		if !ok {
+			for k, e := range m {
+				if strings.EqualFold(k, name) {
+					x, ok = e, true
+					break
+				}
+			}
+		}
+		if !ok {
+			continue
+		}
+		if err := assign(v.Field(i), x); err != nil {
+			return fmt.Errorf("%v: %v", name, err)
+		}
+	}
+	return nil
+}
+
+// 可以由字符串设置的字段
+type field struct {
+	names []string // 字段路径
+	tag   reflect.StructTag
+	v     reflect.Value
+}
+
+func (f field) path() string {
+	return strings.Join(f.names, ".")
+}
+
+func (f field) env(prefix string) string {
+	if name := f.tag.Get("env"); name != "" {
+		return name
+	}
+	words := make([]string, len(f.names))
+	for i, name := range f.names {
+		words[i] = strings.ToUpper(strings.Join(split(name), "_"))
+	}
+	return prefix + strings.Join(words, "_")
+}
+
+func (f field) flag() string {
+	if name := f.tag.Get("flag"); name != "" {
+		return name
+	}
+	words := make([]string, len(f.names))
+	for i, name := range f.names {
+		words[i] = strings.ToLower(strings.Join(split(name), "-"))
+	}
+	return strings.Join(words, ".")
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+func collect(v reflect.Value, names []string, fields *[]field) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.PkgPath != "" {
+			continue
+		}
+		path := append(append([]string(nil), names...), sf.Name)
+		fv := v.Field(i)
+		if fv.Kind() == reflect.Struct && fv.Type() != durationType {
+			collect(fv, path, fields)
+			continue
+		}
+		if settable(fv.Type()) {
+			*fields = append(*fields, field{names: path, tag: sf.Tag, v: fv})
+		}
+	}
+}
+
+func settable(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.String, reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	case reflect.Slice:
+		return t.Elem().Kind() == reflect.String
+	}
+	return false
+}
+
+func setValue(v reflect.Value, s string) error {
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if v.Type() == durationType {
+			d, err := time.ParseDuration(s)
+			if err != nil {
+				return err
+			}
+			v.SetInt(int64(d))
+			return nil
+		}
+		n, err := strconv.ParseInt(s, 0, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 0, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(n)
+	case reflect.Slice:
+		var ss []string
+		for _, e := range strings.Split(s, ",") {
+			if e = strings.TrimSpace(e); e != "" {
+				ss = append(ss, e)
+			}
+		}
+		v.Set(reflect.ValueOf(ss).Convert(v.Type()))
+	}
+	return nil
+}
+
+// 驼峰命名拆分为单词，连续的大写字母作为一个单词，例如 HTTPTimeout 拆分为 HTTP、Timeout
+func split(name string) []string {
+	var words []string
+	rs := []rune(name)
+	start := 0
+	for i := 1; i < len(rs); i++ {
+		if !unicode.IsUpper(rs[i]) {
+			continue
+		}
+		if !unicode.IsUpper(rs[i-1]) || i+1 < len(rs) && unicode.IsLower(rs[i+1]) {
+			words = append(words, string(rs[start:i]))
+			start = i
+		}
+	}
+	return append(words, string(rs[start:]))
+}
+
+// 命令行参数
+type flagValue struct {
+	v reflect.Value
+}
+
+func (f *flagValue) String() string {
+	if f == nil || !f.v.IsValid() {
+		return ""
+	}
+	return fmt.Sprint(f.v.Interface())
+}
+
+func (f *flagValue) Set(s string) error {
+	return setValue(f.v, s)
+}
+
+// IsBoolFlag bool 类型的参数可以省略值
+func (f *flagValue) IsBoolFlag() bool {
+	return f.v.IsValid() && f.v.Kind() == reflect.Bool
+}
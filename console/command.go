@@ -5,6 +5,7 @@ import (
 	"os"
 	"path"
 	"runtime/pprof"
+	"strings"
 	"time"
 
 	"github.com/skeletongo/leaf.v1/chanrpc"
@@ -16,6 +17,7 @@ var commands = []Command{
 	new(CommandHelp),
 	new(CommandCPUProf),
 	new(CommandProf),
+	new(CommandChanRPC),
 }
 
 type Command interface {
@@ -76,8 +78,45 @@ func Register(name string, help string, f interface{}, server *chanrpc.Server) {
 	commands = append(commands, c)
 }
 
+// FuncCommand 在 console 协程中直接执行的命令
+type FuncCommand struct {
+	_name string
+	_help string
+	f     func(args []string) string
+}
+
+func (c *FuncCommand) name() string {
+	return c._name
+}
+
+func (c *FuncCommand) help() string {
+	return c._help
+}
+
+func (c *FuncCommand) run(args []string) string {
+	return c.f(args)
+}
+
+// RegisterFunc 注册在 console 协程中直接执行的命令，f 必须线程安全
+// 需要在 console.Init 之前调用，非线程安全
+func RegisterFunc(name string, help string, f func(args []string) string) {
+	for _, c := range commands {
+		if c.name() == name {
+			log.Fatal("command %v is already registered", name)
+		}
+	}
+
+	c := new(FuncCommand)
+	c._name = name
+	c._help = help
+	c.f = f
+	commands = append(commands, c)
+}
+
 // help
-type CommandHelp struct{}
+type CommandHelp struct {
+	console *Console // 为 nil 时只列出全局注册的命令
+}
 
 func (c *CommandHelp) name() string {
 	return "help"
@@ -88,8 +127,12 @@ func (c *CommandHelp) help() string {
 }
 
 func (c *CommandHelp) run([]string) string {
+	cmds := commands
+	if c.console != nil {
+		cmds = c.console.all()
+	}
 	output := "Commands:\r\n"
-	for _, c := range commands {
+	for _, c := range cmds {
 		output += c.name() + " - " + c.help() + "\r\n"
 	}
 	output += "quit - exit console"
@@ -213,3 +256,54 @@ func (c *CommandProf) run(args []string) string {
 
 	return fn
 }
+
+// chanrpc
+type CommandChanRPC struct{}
+
+func (c *CommandChanRPC) name() string {
+	return "chanrpc"
+}
+
+func (c *CommandChanRPC) help() string {
+	return "channel rpc server statistics"
+}
+
+func (c *CommandChanRPC) usage() string {
+	return "chanrpc shows statistics of the channel rpc servers of named modules\r\n\r\n" +
+		"Usage: chanrpc [name]\r\n" +
+		"  name - show statistics of each function of the module"
+}
+
+func (c *CommandChanRPC) run(args []string) string {
+	all := chanrpc.AllStats()
+	if len(args) == 0 {
+		if len(all) == 0 {
+			return "no module is monitored"
+		}
+		var output []string
+		for _, ss := range all {
+			output = append(output, fmt.Sprintf("%v - queue: %v/%v, calls: %v, rate: %v/s, panics: %v, pending async: %v, "+
+				"dropped: %v, rejected: %v, timeout: %v, go fails: %v",
+				ss.Name, ss.QueueLen, ss.QueueCap, ss.Calls, ss.Rate, ss.Panics, ss.PendingAsync,
+				ss.Overflow.Dropped, ss.Overflow.Rejected, ss.Overflow.Timeout, ss.GoFails))
+		}
+		return strings.Join(output, "\r\n")
+	}
+
+	for _, ss := range all {
+		if ss.Name != args[0] {
+			continue
+		}
+		output := []string{"histogram buckets: " + fmt.Sprint(chanrpc.HistogramBuckets[:]) + ", +Inf"}
+		for _, f := range ss.Funcs {
+			var avg time.Duration
+			if f.Calls > 0 {
+				avg = f.TotalTime / time.Duration(f.Calls)
+			}
+			output = append(output, fmt.Sprintf("%v - calls: %v, rate: %v/s, panics: %v, total: %v, avg: %v, max: %v, histogram: %v",
+				f.ID, f.Calls, f.Rate, f.Panics, f.TotalTime, avg, f.MaxTime, f.Histogram))
+		}
+		return strings.Join(output, "\r\n")
+	}
+	return c.usage()
+}
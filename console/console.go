@@ -7,34 +7,107 @@ import (
 	"strings"
 
 	"github.com/skeletongo/leaf.v1/conf"
+	"github.com/skeletongo/leaf.v1/log"
 	"github.com/skeletongo/leaf.v1/network"
 )
 
-var server *network.TCPServer
+// Console 控制台服务，只监听本机地址
+// 除了全局注册的命令，每个实例还可以注册自己的命令
+type Console struct {
+	Port   int // 为 0 时不启动
+	Prompt string
 
+	server   *network.TCPServer
+	commands []Command // 本实例的命令，优先于全局注册的命令
+}
+
+var std *Console
+
+// Init 按 conf 中的配置启动控制台
 func Init() {
-	if conf.ConsolePort == 0 {
+	std = &Console{
+		Port:   conf.ConsolePort,
+		Prompt: conf.ConsolePrompt,
+	}
+	std.Start()
+}
+
+func Destroy() {
+	if std != nil {
+		std.Close()
+	}
+}
+
+// RegisterFunc 注册本实例的命令，在 console 协程中直接执行，f 必须线程安全
+// you must call the function before calling Start
+func (c *Console) RegisterFunc(name string, help string, f func(args []string) string) {
+	if c.command(name) != nil {
+		log.Fatal("command %v is already registered", name)
+	}
+
+	c.commands = append(c.commands, &FuncCommand{_name: name, _help: help, f: f})
+}
+
+func (c *Console) Start() {
+	if c.Port == 0 {
 		return
 	}
 
-	server = new(network.TCPServer)
-	server.Addr = "localhost:" + strconv.Itoa(conf.ConsolePort)
-	server.MaxConnNum = int(math.MaxInt32)
-	server.PendingWriteNum = 100
-	server.NewAgent = newAgent
+	// help 列出本实例的所有命令
+	if h, _ := c.command("help").(*CommandHelp); h == nil || h.console != c {
+		c.commands = append([]Command{&CommandHelp{console: c}}, c.commands...)
+	}
+
+	c.server = new(network.TCPServer)
+	c.server.Addr = "localhost:" + strconv.Itoa(c.Port)
+	c.server.MaxConnNum = int(math.MaxInt32)
+	c.server.PendingWriteNum = 100
+	c.server.NewAgent = func(conn *network.TCPConn) network.Agent {
+		a := newAgent(conn).(*Agent)
+		a.console = c
+		return a
+	}
 
-	server.Start()
+	c.server.Start()
 }
 
-func Destroy() {
-	if server != nil {
-		server.Close()
+func (c *Console) Close() {
+	if c.server != nil {
+		c.server.Close()
+	}
+}
+
+func (c *Console) command(name string) Command {
+	for _, _c := range c.all() {
+		if _c.name() == name {
+			return _c
+		}
+	}
+	return nil
+}
+
+// 本实例的命令及全局注册的命令，同名时本实例的命令优先
+func (c *Console) all() []Command {
+	all := append([]Command(nil), c.commands...)
+	for _, g := range commands {
+		shadowed := false
+		for _, _c := range c.commands {
+			if _c.name() == g.name() {
+				shadowed = true
+				break
+			}
+		}
+		if !shadowed {
+			all = append(all, g)
+		}
 	}
+	return all
 }
 
 type Agent struct {
-	conn   *network.TCPConn
-	reader *bufio.Reader
+	conn    *network.TCPConn
+	reader  *bufio.Reader
+	console *Console
 }
 
 func newAgent(conn *network.TCPConn) network.Agent {
@@ -46,7 +119,7 @@ func newAgent(conn *network.TCPConn) network.Agent {
 
 func (a *Agent) Run() {
 	for {
-		a.conn.Write([]byte(conf.ConsolePrompt))
+		a.conn.Write([]byte(a.console.Prompt))
 
 		line, err := a.reader.ReadString('\n')
 		if err != nil {
@@ -61,13 +134,7 @@ func (a *Agent) Run() {
 		if args[0] == "quit" {
 			break
 		}
-		var c Command
-		for _, _c := range commands {
-			if _c.name() == args[0] {
-				c = _c
-				break
-			}
-		}
+		c := a.console.command(args[0])
 		if c == nil {
 			a.conn.Write([]byte("command not found, try `help` for help\r\n"))
 			continue
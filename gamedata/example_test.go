@@ -0,0 +1,88 @@
+package gamedata_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/skeletongo/leaf.v1/gamedata"
+)
+
+type Item struct {
+	ID   int    `gamedata:"id,key"`
+	Name string `gamedata:"name"`
+	Type int32  `gamedata:"type,index"`
+}
+
+type Drop struct {
+	ID    int     `json:"id" gamedata:",key"`
+	Items []int   `json:"items" gamedata:",ref=item"`
+	Rate  float64 `json:"rate"`
+}
+
+func Example() {
+	dir, _ := os.MkdirTemp("", "gamedata")
+	defer os.RemoveAll(dir)
+	itemFile := filepath.Join(dir, "item.csv")
+	dropFile := filepath.Join(dir, "drop.json")
+	os.WriteFile(itemFile, []byte("id,name,type\n# 策划备注\n1,sword,1\n2,shield,1\n3,potion,2\n"), 0644)
+	os.WriteFile(dropFile, []byte(`[{"id": 1, "items": [1, 3], "rate": 0.5}]`), 0644)
+
+	items := gamedata.NewTable[int, Item]("item", itemFile)
+	drops := gamedata.NewTable[int, Drop]("drop", dropFile)
+	set := gamedata.NewSet("demo", items, drops)
+	if err := set.Load(); err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	fmt.Println(items.Len(), items.Get(2).Name, len(items.Index("Type", 1)))
+	fmt.Println(drops.Get(1).Items, drops.Get(1).Rate)
+	// 查找的值转换为字段的类型，不能转换时找不到
+	fmt.Println(len(items.Index("Type", uint8(2))), len(items.Index("Type", "2")), len(items.Index("Name", "sword")))
+
+	// 引用检查失败时保持原来的数据
+	os.WriteFile(dropFile, []byte(`[{"id": 1, "items": [4]}]`), 0644)
+	fmt.Println(set.Load())
+	fmt.Println(drops.Get(1).Items)
+
+	// 所有表一起替换
+	os.WriteFile(itemFile, []byte("id,name,type\n1,sword,1\n4,bow,1\n"), 0644)
+	fmt.Println(set.Load())
+	fmt.Println(items.Len(), drops.Get(1).Items)
+
+	// Output:
+	// 3 shield 2
+	// [1 3] 0.5
+	// 1 0 0
+	// gamedata demo: table drop: row 1 field Items refers to missing item 4
+	// [1 3]
+	// <nil>
+	// 2 [4]
+}
+
+type Hero struct {
+	Name string `gamedata:"name,key"`
+}
+
+type Skill struct {
+	ID   int   `gamedata:"id,key"`
+	Hero int32 `gamedata:"hero,ref=hero"`
+}
+
+func ExampleSet() {
+	dir, _ := os.MkdirTemp("", "gamedata")
+	defer os.RemoveAll(dir)
+	heroFile := filepath.Join(dir, "hero.csv")
+	skillFile := filepath.Join(dir, "skill.csv")
+	os.WriteFile(heroFile, []byte("name\nA\n"), 0644)
+	os.WriteFile(skillFile, []byte("id,hero\n1,65\n"), 0644)
+
+	// 整数不能引用字符串主键，即使 65 可以转换为 "A"
+	set := gamedata.NewSet("hero", gamedata.NewTable[string, Hero]("hero", heroFile),
+		gamedata.NewTable[int, Skill]("skill", skillFile))
+	fmt.Println(set.Load())
+
+	// Output:
+	// gamedata hero: table skill: row 1 field Hero refers to missing hero 65
+}
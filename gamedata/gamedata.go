@@ -0,0 +1,436 @@
+package gamedata
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/skeletongo/leaf.v1/log"
+)
+
+// Table 数据表，T 为行结构体，K 为主键类型
+//
+// CSV、TSV 文件第一行为列名，以 # 开头的行为注释，空单元格为零值
+// 列与字段的对应关系由字段标签 gamedata 指定：
+//
+//	ID     int    `gamedata:"id,key"`       // 列名 id，主键
+//	Type   int    `gamedata:"type,index"`   // 列名 type，建立二级索引
+//	ItemID int    `gamedata:"item,ref=item"` // 列名 item，引用 item 表的主键，为零值时不检查
+//	Memo   string `gamedata:"-"`             // 忽略
+//
+// 没有标签的导出字段列名为字段名；slice、map、struct 类型的单元格按 JSON 解析
+// 索引字段必须可比较，不能是 slice、map 或者 interface
+// JSON 文件为对象数组，按 encoding/json 的规则解析，gamedata 标签只用于主键、索引和引用
+type Table[K comparable, T any] struct {
+	name    string
+	file    string
+	comma   rune
+	columns []column
+	key     int                     // 主键字段的下标，-1 表示没有主键
+	indexes map[string]reflect.Type // 二级索引的字段名及字段类型
+	set     *Set                    // 所属的 Set，数据保存在它的快照中
+}
+
+type column struct {
+	field int    // 字段下标
+	name  string // 列名
+	key   bool
+	index bool
+	ref   string // 引用的表名
+}
+
+type data[K comparable, T any] struct {
+	rows    []*T
+	keys    map[K]*T
+	indexes map[string]map[interface{}][]*T
+}
+
+// NewTable 创建数据表，需要加入 Set 后加载，一张表只能加入一个 Set
+// file 的扩展名为 .csv、.tsv 或者 .json
+func NewTable[K comparable, T any](name, file string) *Table[K, T] {
+	t := &Table[K, T]{name: name, file: file, key: -1, indexes: make(map[string]reflect.Type)}
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".csv":
+		t.comma = ','
+	case ".tsv":
+		t.comma = '\t'
+	case ".json":
+	default:
+		log.Fatal("table %v: unsupported file %v", name, file)
+	}
+
+	rt := reflect.TypeOf((*T)(nil)).Elem()
+	if rt.Kind() != reflect.Struct {
+		log.Fatal("table %v: struct required", name)
+	}
+	for i := 0; i < rt.NumField(); i++ {
+		f := rt.Field(i)
+		tag := f.Tag.Get("gamedata")
+		if f.PkgPath != "" || tag == "-" {
+			continue
+		}
+		opts := strings.Split(tag, ",")
+		c := column{field: i, name: opts[0]}
+		if c.name == "" {
+			c.name = f.Name
+		}
+		for _, opt := range opts[1:] {
+			switch {
+			case opt == "key":
+				if t.key >= 0 {
+					log.Fatal("table %v: too many keys", name)
+				}
+				if f.Type != reflect.TypeOf((*K)(nil)).Elem() {
+					log.Fatal("table %v: key %v must be %v", name, f.Name, reflect.TypeOf((*K)(nil)).Elem())
+				}
+				c.key = true
+				t.key = i
+			case opt == "index":
+				// slice、map 等不能作为 map 的键，interface 字段的值也可能不能
+				if !f.Type.Comparable() || f.Type.Kind() == reflect.Interface {
+					log.Fatal("table %v: index %v must be comparable", name, f.Name)
+				}
+				c.index = true
+				t.indexes[f.Name] = f.Type
+			case strings.HasPrefix(opt, "ref="):
+				c.ref = strings.TrimPrefix(opt, "ref=")
+			default:
+				log.Fatal("table %v: invalid tag option %v", name, opt)
+			}
+		}
+		t.columns = append(t.columns, c)
+	}
+	return t
+}
+
+// Name 表名
+func (t *Table[K, T]) Name() string {
+	return t.name
+}
+
+// 当前快照中的数据，未加载时返回 nil
+func (t *Table[K, T]) cur() *data[K, T] {
+	if t.set == nil {
+		return nil
+	}
+	snap := t.set.cur.Load()
+	if snap == nil {
+		return nil
+	}
+	d, _ := (*snap)[t].(*data[K, T])
+	return d
+}
+
+// All 所有行，按文件中的顺序排列，不能修改
+// 线程安全
+func (t *Table[K, T]) All() []*T {
+	if d := t.cur(); d != nil {
+		return d.rows
+	}
+	return nil
+}
+
+// Get 按主键查找，找不到时返回 nil
+// 线程安全
+func (t *Table[K, T]) Get(key K) *T {
+	if d := t.cur(); d != nil {
+		return d.keys[key]
+	}
+	return nil
+}
+
+// Index 按二级索引查找，field 为字段名
+// value 转换为字段的类型后查找，例如可以用 1 查找 int32 字段；
+// field 不是索引字段或者 value 不能无损转换(例如整数与字符串之间、溢出)时返回 nil
+// 线程安全
+func (t *Table[K, T]) Index(field string, value interface{}) []*T {
+	ft, ok := t.indexes[field]
+	if !ok {
+		return nil
+	}
+	v, ok := convertIndex(value, ft)
+	if !ok {
+		return nil
+	}
+	if d := t.cur(); d != nil {
+		return d.indexes[field][v]
+	}
+	return nil
+}
+
+// 把查找的值转换为索引字段的类型，只允许整数之间、浮点数之间及字符串之间不会溢出的转换
+func convertIndex(value interface{}, to reflect.Type) (interface{}, bool) {
+	v := reflect.ValueOf(value)
+	if !v.IsValid() {
+		return nil, false
+	}
+	if v.Type() == to {
+		return value, true
+	}
+	zero := reflect.Zero(to)
+	switch {
+	case isInt(v.Kind()) && isInt(to.Kind()):
+		if zero.OverflowInt(v.Int()) {
+			return nil, false
+		}
+	case isInt(v.Kind()) && isUint(to.Kind()):
+		if v.Int() < 0 || zero.OverflowUint(uint64(v.Int())) {
+			return nil, false
+		}
+	case isUint(v.Kind()) && isUint(to.Kind()):
+		if zero.OverflowUint(v.Uint()) {
+			return nil, false
+		}
+	case isUint(v.Kind()) && isInt(to.Kind()):
+		if v.Uint() > math.MaxInt64 || zero.OverflowInt(int64(v.Uint())) {
+			return nil, false
+		}
+	case isFloat(v.Kind()) && isFloat(to.Kind()):
+		if zero.OverflowFloat(v.Float()) {
+			return nil, false
+		}
+	case v.Kind() == reflect.String && to.Kind() == reflect.String:
+	default:
+		return nil, false
+	}
+	return v.Convert(to).Interface(), true
+}
+
+func isInt(k reflect.Kind) bool {
+	return k >= reflect.Int && k <= reflect.Int64
+}
+
+func isUint(k reflect.Kind) bool {
+	return k >= reflect.Uint && k <= reflect.Uintptr
+}
+
+func isFloat(k reflect.Kind) bool {
+	return k == reflect.Float32 || k == reflect.Float64
+}
+
+// Len 行数
+// 线程安全
+func (t *Table[K, T]) Len() int {
+	return len(t.All())
+}
+
+func (t *Table[K, T]) attach(s *Set) {
+	if t.set != nil {
+		log.Fatal("table %v is already in set %v", t.name, t.set.name)
+	}
+	t.set = s
+}
+
+// 加载新的数据，替换快照前不影响读取
+func (t *Table[K, T]) load() (interface{}, error) {
+	rows, err := t.read()
+	if err != nil {
+		return nil, fmt.Errorf("table %v: %v", t.name, err)
+	}
+
+	d := &data[K, T]{
+		rows:    rows,
+		keys:    make(map[K]*T, len(rows)),
+		indexes: make(map[string]map[interface{}][]*T),
+	}
+	rt := reflect.TypeOf((*T)(nil)).Elem()
+	for i, row := range rows {
+		rv := reflect.ValueOf(row).Elem()
+		if t.key >= 0 {
+			key := rv.Field(t.key).Interface().(K)
+			if _, ok := d.keys[key]; ok {
+				return nil, fmt.Errorf("table %v: duplicate key %v at row %v", t.name, key, i+1)
+			}
+			d.keys[key] = row
+		}
+		for _, c := range t.columns {
+			if !c.index {
+				continue
+			}
+			name := rt.Field(c.field).Name
+			if d.indexes[name] == nil {
+				d.indexes[name] = make(map[interface{}][]*T)
+			}
+			v := rv.Field(c.field).Interface()
+			d.indexes[name][v] = append(d.indexes[name][v], row)
+		}
+	}
+	return d, nil
+}
+
+func (t *Table[K, T]) read() ([]*T, error) {
+	f, err := os.Open(t.file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var rows []*T
+	if t.comma == 0 {
+		if err := json.NewDecoder(f).Decode(&rows); err != nil {
+			return nil, err
+		}
+		return rows, nil
+	}
+
+	r := csv.NewReader(f)
+	r.Comma = t.comma
+	r.Comment = '#'
+	r.FieldsPerRecord = -1
+	if t.comma == '\t' {
+		r.LazyQuotes = true
+	}
+
+	header, err := r.Read()
+	if err != nil {
+		return nil, err
+	}
+	pos := make(map[string]int, len(header))
+	for i, name := range header {
+		pos[strings.TrimSpace(name)] = i
+	}
+	cols := make([]int, len(t.columns))
+	for i, c := range t.columns {
+		p, ok := pos[c.name]
+		if !ok {
+			return nil, fmt.Errorf("column %v not found", c.name)
+		}
+		cols[i] = p
+	}
+
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, _ := r.FieldPos(0)
+
+		row := new(T)
+		rv := reflect.ValueOf(row).Elem()
+		for i, c := range t.columns {
+			if cols[i] >= len(record) {
+				continue
+			}
+			if err := setCell(rv.Field(c.field), strings.TrimSpace(record[cols[i]])); err != nil {
+				return nil, fmt.Errorf("line %v column %v: %v", line, c.name, err)
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+func setCell(v reflect.Value, s string) error {
+	if s == "" {
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 0, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 0, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(n)
+	case reflect.Slice, reflect.Map, reflect.Struct, reflect.Array, reflect.Ptr:
+		return json.Unmarshal([]byte(s), v.Addr().Interface())
+	default:
+		return fmt.Errorf("unsupported type %v", v.Type())
+	}
+	return nil
+}
+
+// 检查新数据中的引用，tables 为同一个 Set 中的表，pending 为它们的新数据
+func (t *Table[K, T]) check(d interface{}, tables map[string]loadable, pending snapshot) error {
+	rt := reflect.TypeOf((*T)(nil)).Elem()
+	for _, c := range t.columns {
+		if c.ref == "" {
+			continue
+		}
+		target, ok := tables[c.ref]
+		if !ok {
+			return fmt.Errorf("table %v: field %v refers to unknown table %v", t.name, rt.Field(c.field).Name, c.ref)
+		}
+		for i, row := range d.(*data[K, T]).rows {
+			fv := reflect.ValueOf(row).Elem().Field(c.field)
+			values := []reflect.Value{fv}
+			if fv.Kind() == reflect.Slice || fv.Kind() == reflect.Array {
+				values = values[:0]
+				for j := 0; j < fv.Len(); j++ {
+					values = append(values, fv.Index(j))
+				}
+			}
+			for _, v := range values {
+				if v.IsZero() {
+					continue
+				}
+				if !target.has(pending[target], v) {
+					return fmt.Errorf("table %v: row %v field %v refers to missing %v %v",
+						t.name, i+1, rt.Field(c.field).Name, c.ref, v.Interface())
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// 新数据 d 中是否有主键 v
+// 引用字段与主键类型不同时，只允许同为有符号整数、同为无符号整数或者同为字符串，且不会截断的转换
+func (t *Table[K, T]) has(d interface{}, v reflect.Value) bool {
+	kt := reflect.TypeOf((*K)(nil)).Elem()
+	if !keyConvertible(v.Type(), kt) {
+		return false
+	}
+	_, ok := d.(*data[K, T]).keys[v.Convert(kt).Interface().(K)]
+	return ok
+}
+
+func keyConvertible(from, to reflect.Type) bool {
+	if from == to {
+		return true
+	}
+	switch from.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		switch to.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return from.Bits() <= to.Bits()
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		switch to.Kind() {
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			return from.Bits() <= to.Bits()
+		}
+	case reflect.String:
+		return to.Kind() == reflect.String
+	}
+	return false
+}
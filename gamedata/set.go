@@ -0,0 +1,145 @@
+package gamedata
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/skeletongo/leaf.v1/console"
+	"github.com/skeletongo/leaf.v1/log"
+)
+
+// 可以加入 Set 的数据表，即 *Table
+// 数据表加载得到的数据为 interface{}，即 *data，保存在 Set 的快照中
+type loadable interface {
+	Name() string
+	Len() int
+	attach(s *Set)
+	load() (interface{}, error)
+	check(d interface{}, tables map[string]loadable, pending snapshot) error
+	has(d interface{}, v reflect.Value) bool
+}
+
+// 一个版本的所有表的数据
+type snapshot map[loadable]interface{}
+
+// Set 一组相互引用的数据表，一起加载
+// 所有表加载并且引用检查通过后，通过一次原子操作替换所有表的数据，任何一张表出错时所有表保持原来的数据
+type Set struct {
+	name   string
+	mu     sync.Mutex // 串行化加载
+	tables []loadable
+	cur    atomic.Pointer[snapshot]
+}
+
+var (
+	muSets sync.Mutex
+	sets   []*Set
+)
+
+func init() {
+	console.RegisterFunc("gamedata", "show or reload game data, usage: gamedata [reload [set]]", commandGameData)
+}
+
+// NewSet 创建数据表集合，name 用于 console 的 gamedata 命令
+func NewSet(name string, tables ...loadable) *Set {
+	s := &Set{name: name, tables: tables}
+	names := make(map[string]bool)
+	for _, t := range tables {
+		if names[t.Name()] {
+			log.Fatal("gamedata %v: table %v is already added", name, t.Name())
+		}
+		names[t.Name()] = true
+		t.attach(s)
+	}
+
+	muSets.Lock()
+	sets = append(sets, s)
+	muSets.Unlock()
+	return s
+}
+
+// Load 加载或者重新加载所有表
+// 线程安全
+func (s *Set) Load() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tables := make(map[string]loadable, len(s.tables))
+	for _, t := range s.tables {
+		tables[t.Name()] = t
+	}
+
+	pending, err := s.load(tables)
+	if err != nil {
+		return fmt.Errorf("gamedata %v: %w", s.name, err)
+	}
+	s.cur.Store(&pending)
+	return nil
+}
+
+func (s *Set) load(tables map[string]loadable) (snapshot, error) {
+	pending := make(snapshot, len(s.tables))
+	for _, t := range s.tables {
+		d, err := t.load()
+		if err != nil {
+			return nil, err
+		}
+		pending[t] = d
+	}
+	for _, t := range s.tables {
+		if err := t.check(pending[t], tables, pending); err != nil {
+			return nil, err
+		}
+	}
+	return pending, nil
+}
+
+func (s *Set) String() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	output := []string{s.name}
+	for _, t := range s.tables {
+		output = append(output, fmt.Sprintf("  %v - %v rows", t.Name(), t.Len()))
+	}
+	return strings.Join(output, "\r\n")
+}
+
+func commandGameData(args []string) string {
+	muSets.Lock()
+	ss := append([]*Set(nil), sets...)
+	muSets.Unlock()
+
+	if len(args) == 0 {
+		if len(ss) == 0 {
+			return "no game data"
+		}
+		var output []string
+		for _, s := range ss {
+			output = append(output, s.String())
+		}
+		return strings.Join(output, "\r\n")
+	}
+
+	if args[0] != "reload" {
+		return "Usage: gamedata [reload [set]]"
+	}
+	var output []string
+	for _, s := range ss {
+		if len(args) > 1 && s.name != args[1] {
+			continue
+		}
+		if err := s.Load(); err != nil {
+			output = append(output, err.Error())
+		} else {
+			output = append(output, fmt.Sprintf("gamedata %v reloaded", s.name))
+		}
+	}
+	if len(output) == 0 {
+		return fmt.Sprintf("game data %v not found", args[1])
+	}
+	return strings.Join(output, "\r\n")
+}
@@ -0,0 +1,145 @@
+package gate
+
+import (
+	"container/list"
+	"reflect"
+	"time"
+
+	"github.com/skeletongo/leaf.v1/log"
+	"github.com/skeletongo/leaf.v1/network"
+)
+
+// AdmitResult 连接准入结果
+type AdmitResult int
+
+const (
+	AdmitAccept AdmitResult = iota // 接受连接
+	AdmitReject                    // 拒绝连接
+	AdmitQueue                     // 连接进入排队
+)
+
+// ConnInfo 连接准入信息
+type ConnInfo struct {
+	*network.ConnInfo
+	AgentNum int // 已准入的连接数
+	QueueLen int // 排队中的连接数
+	QueuePos int // 此连接的排队位置，从 1 开始，未排队时为 0；前面有连接中途离开时位置偏大，下一次判断时修正
+}
+
+// 排队中的连接
+type waiter struct {
+	seq  uint64        // 排队序号
+	wake chan struct{} // 排到队首且有连接释放时被唤醒
+}
+
+func (g *Gate) initAdmit() {
+	if g.QueueInterval <= 0 {
+		g.QueueInterval = 3 * time.Second
+	}
+	if g.QueueTimeout <= 0 {
+		g.QueueTimeout = 10 * time.Minute
+	}
+	g.queue = list.New()
+	g.closing = make(chan struct{})
+}
+
+// 在连接协程中执行，排队时阻塞直到准入、被拒绝、排队超时或者网关关闭
+func (g *Gate) admit(conn network.Conn, info *network.ConnInfo) bool {
+	ci := &ConnInfo{ConnInfo: info}
+
+	var e *list.Element
+	defer func() {
+		if e != nil {
+			g.mu.Lock()
+			g.leave(e)
+			g.mu.Unlock()
+		}
+	}()
+
+	timeout := time.NewTimer(g.QueueTimeout)
+	defer timeout.Stop()
+	for {
+		g.mu.Lock()
+		ci.AgentNum = g.agentNum
+		ci.QueueLen = g.queue.Len()
+		ci.QueuePos = 0
+		if e != nil {
+			head := g.queue.Front().Value.(*waiter)
+			ci.QueuePos = int(e.Value.(*waiter).seq-head.seq) + 1
+		}
+		result, reason := g.Admit(ci)
+		if result == AdmitAccept {
+			g.agentNum++
+		}
+		if result == AdmitQueue && e == nil {
+			e = g.queue.PushBack(&waiter{seq: g.queueSeq, wake: make(chan struct{}, 1)})
+			g.queueSeq++
+		}
+		g.mu.Unlock()
+
+		if reason != nil && !g.writeReason(conn, reason) {
+			if result == AdmitAccept {
+				g.release()
+			}
+			return false
+		}
+
+		switch result {
+		case AdmitAccept:
+			return true
+		case AdmitReject:
+			return false
+		}
+
+		select {
+		case <-g.closing:
+			return false
+		case <-timeout.C:
+			log.Debug("queue timeout: %v", info.RemoteAddr)
+			return false
+		case <-e.Value.(*waiter).wake:
+		case <-time.After(g.QueueInterval):
+		}
+	}
+}
+
+// 离开队列，队首离开时唤醒新的队首，使释放的多个位置依次被使用
+// 调用方需要加锁
+func (g *Gate) leave(e *list.Element) {
+	head := g.queue.Front() == e
+	g.queue.Remove(e)
+	if head {
+		g.wakeHead()
+	}
+}
+
+// 调用方需要加锁
+func (g *Gate) wakeHead() {
+	if front := g.queue.Front(); front != nil {
+		select {
+		case front.Value.(*waiter).wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// 已准入的连接关闭，唤醒队首的连接
+func (g *Gate) release() {
+	g.mu.Lock()
+	g.agentNum--
+	g.wakeHead()
+	g.mu.Unlock()
+}
+
+func (g *Gate) writeReason(conn network.Conn, reason interface{}) bool {
+	data, err := g.Processor.Marshal(reason)
+	if err != nil {
+		log.Error("marshal message %v error: %v", reflect.TypeOf(reason), err)
+		return false
+	}
+	if err = conn.WriteMsg(data...); err != nil {
+		log.Debug("write message %v error: %v", reflect.TypeOf(reason), err)
+		return false
+	}
+	return true
+}
@@ -2,12 +2,15 @@ package gate
 
 import (
 	"net"
+	"net/http"
 )
 
 type Agent interface {
 	WriteMsg(msg interface{})
 	LocalAddr() net.Addr
 	RemoteAddr() net.Addr
+	Request() *http.Request // websocket 握手请求，tcp 连接为 nil
+	Subprotocol() string    // websocket 协商后的子协议，tcp 连接为空
 	Close()
 	Destroy()
 	UserData() interface{}
@@ -1,13 +1,18 @@
 package gate
 
 import (
+	"container/list"
+	"context"
 	"net"
+	"net/http"
 	"reflect"
+	"sync"
 	"time"
 
 	"github.com/skeletongo/leaf.v1/chanrpc"
 	"github.com/skeletongo/leaf.v1/log"
 	"github.com/skeletongo/leaf.v1/network"
+	"github.com/skeletongo/leaf.v1/trace"
 )
 
 type Gate struct {
@@ -22,17 +27,53 @@ type Gate struct {
 	HTTPTimeout time.Duration
 	CertFile    string
 	KeyFile     string
+	// CheckOrigin 为 nil 时接受所有来源
+	// Auth 握手鉴权，返回 http.StatusOK 以外的状态码时拒绝升级
+	CheckOrigin  func(r *http.Request) bool
+	Subprotocols []string
+	Auth         func(r *http.Request) int
+	// TrustedProxies 受信任的 L7 代理(IP 或 CIDR)，来自它们的连接按 X-Forwarded-For/X-Real-IP 取客户端地址
+	TrustedProxies []string
+	// WSPath websocket 服务路径，默认为 "/"
+	// WSMux 不为 nil 时 websocket 服务挂载到它的 WSPath 上，同一端口可以提供健康检查、监控等 HTTP 接口
+	// 设置 WSMux 时 WSAddr 可以为空，此时不监听端口，由调用方自己的 HTTP 服务提供 WSMux
+	WSPath string
+	WSMux  *http.ServeMux
+	// WSFrameType 发送消息使用的帧类型，使用 json Processor 时可以设为 network.FrameText 或 network.FrameMirror
+	WSFrameType network.FrameType
 
 	// tcp
 	TCPAddr      string
 	ByteLen      int
 	LittleEndian bool
+	// ProxyProtocol 经过 L4 负载均衡转发，连接以 PROXY 协议头(v1/v2)开始
+	ProxyProtocol bool
+
+	// 连接准入
+	// Admit 为 nil 时只按 MaxConnNum 限制连接数，超出时直接断开连接
+	// Admit 不为 nil 时由它决定接受、拒绝或者排队，在锁内调用不能阻塞
+	// reason 不为 nil 时经 Processor 编码后发送给客户端，例如拒绝原因或者排队位置
+	Admit         func(info *ConnInfo) (result AdmitResult, reason interface{})
+	QueueInterval time.Duration // 排队中的连接重新判断准入的时间间隔
+	// QueueTimeout 排队的最长时间，超时后断开连接，默认 10 分钟
+	// 排队时 reason 为 nil 不会向客户端写数据，已经断开的客户端要等到超时才让出位置
+	QueueTimeout time.Duration
+	mu           sync.Mutex
+	agentNum     int
+	queue        *list.List // 排队中的 *waiter，按先后顺序排列
+	queueSeq     uint64     // 下一个排队连接的序号
+	closing      chan struct{}
 }
 
 func (g *Gate) Run(closeSig chan struct{}) {
 	if g.Processor == nil {
 		log.Fatal("message Processor required")
 	}
+	var admit func(network.Conn, *network.ConnInfo) bool
+	if g.Admit != nil {
+		g.initAdmit()
+		admit = g.admit
+	}
 	// tcpServer
 	var tcpServer *network.TCPServer
 	if g.TCPAddr != "" {
@@ -43,6 +84,8 @@ func (g *Gate) Run(closeSig chan struct{}) {
 			ByteLen:         g.ByteLen,
 			MaxPkgLen:       g.MaxPkgLen,
 			LittleEndian:    g.LittleEndian,
+			ProxyProtocol:   g.ProxyProtocol,
+			Admit:           admit,
 			NewAgent: func(conn *network.TCPConn) network.Agent {
 				a := &agent{conn: conn, gate: g}
 				if g.AgentChanRPC != nil {
@@ -54,7 +97,7 @@ func (g *Gate) Run(closeSig chan struct{}) {
 	}
 	//wsServer
 	var wsServer *network.WSServer
-	if g.WSAddr != "" {
+	if g.WSAddr != "" || g.WSMux != nil {
 		wsServer = &network.WSServer{
 			Addr:            g.WSAddr,
 			MaxConnNum:      g.MaxConnNum,
@@ -63,6 +106,14 @@ func (g *Gate) Run(closeSig chan struct{}) {
 			HTTPTimeout:     g.HTTPTimeout,
 			CertFile:        g.CertFile,
 			KeyFile:         g.KeyFile,
+			CheckOrigin:     g.CheckOrigin,
+			Subprotocols:    g.Subprotocols,
+			Auth:            g.Auth,
+			TrustedProxies:  g.TrustedProxies,
+			Path:            g.WSPath,
+			Mux:             g.WSMux,
+			FrameType:       g.WSFrameType,
+			Admit:           admit,
 			NewAgent: func(conn *network.WSConn) network.Agent {
 				a := &agent{conn: conn, gate: g}
 				if g.AgentChanRPC != nil {
@@ -80,6 +131,9 @@ func (g *Gate) Run(closeSig chan struct{}) {
 		wsServer.Start()
 	}
 	<-closeSig
+	if g.closing != nil {
+		close(g.closing)
+	}
 	if tcpServer != nil {
 		tcpServer.Close()
 	}
@@ -108,14 +162,32 @@ func (a *agent) Run() {
 			log.Debug("unmarshal message error: %v", err)
 			return
 		}
-		if err = a.gate.Processor.Route(msg, a); err != nil {
+		if err = a.route(msg); err != nil {
 			log.Debug("route message error: %v", err)
 			return
 		}
 	}
 }
 
+// 开启链路追踪时，每条消息开始一条新的链路，经 Processor 传给消息处理模块
+func (a *agent) route(msg interface{}) error {
+	p, ok := a.gate.Processor.(network.ContextProcessor)
+	if !ok || !trace.Enabled() {
+		return a.gate.Processor.Route(msg, a)
+	}
+
+	span := trace.New("gate " + reflect.TypeOf(msg).String())
+	span.SetAttr("net.peer.addr", a.RemoteAddr().String())
+	err := p.RouteContext(trace.NewContext(context.Background(), span), msg, a)
+	span.SetError(err)
+	span.End()
+	return err
+}
+
 func (a *agent) OnClose() {
+	if a.gate.Admit != nil {
+		defer a.gate.release()
+	}
 	if a.gate.AgentChanRPC == nil {
 		return
 	}
@@ -149,6 +221,20 @@ func (a *agent) RemoteAddr() net.Addr {
 	return a.conn.RemoteAddr()
 }
 
+func (a *agent) Request() *http.Request {
+	if c, ok := a.conn.(*network.WSConn); ok {
+		return c.Request()
+	}
+	return nil
+}
+
+func (a *agent) Subprotocol() string {
+	if c, ok := a.conn.(*network.WSConn); ok {
+		return c.Subprotocol()
+	}
+	return ""
+}
+
 func (a *agent) Close() {
 	a.conn.Close()
 }
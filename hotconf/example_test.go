@@ -0,0 +1,97 @@
+package hotconf_test
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/skeletongo/leaf.v1/chanrpc"
+	"github.com/skeletongo/leaf.v1/conf"
+	"github.com/skeletongo/leaf.v1/hotconf"
+)
+
+type Tuning struct {
+	ExpRate  float64 `default:"1"`
+	MaxLevel int     `required:"true"`
+}
+
+func (t *Tuning) Validate() error {
+	if t.ExpRate <= 0 {
+		return errors.New("invalid ExpRate")
+	}
+	return nil
+}
+
+func Example() {
+	dir, _ := os.MkdirTemp("", "hotconf")
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "tuning.json")
+	os.WriteFile(file, []byte(`{"MaxLevel": 60}`), 0644)
+
+	src, err := hotconf.New[Tuning]("tuning", conf.Loader{Files: []string{file}}, 0)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer src.Close()
+	fmt.Println(src.Get().ExpRate, src.Get().MaxLevel)
+
+	// 模块的 ChanRPCServer
+	s := chanrpc.NewServer(10)
+	src.Subscribe(s, "TuningChanged", func(old, new *Tuning) {
+		fmt.Println("MaxLevel", old.MaxLevel, "->", new.MaxLevel)
+	})
+
+	// 校验失败时保持当前配置
+	os.WriteFile(file, []byte(`{"MaxLevel": 70, "ExpRate": -1}`), 0644)
+	fmt.Println(src.Reload())
+
+	os.WriteFile(file, []byte(`{"MaxLevel": 70, "ExpRate": 2}`), 0644)
+	fmt.Println(src.Reload())
+	s.Exec(<-s.ChanCall)
+	fmt.Println(src.Get().ExpRate, src.Get().MaxLevel)
+
+	// Output:
+	// 1 60
+	// conf: invalid ExpRate
+	// <nil>
+	// MaxLevel 60 -> 70
+	// 2 70
+}
+
+func ExampleNew() {
+	dir, _ := os.MkdirTemp("", "hotconf")
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "tuning.json")
+	os.WriteFile(file, []byte(`{"MaxLevel": 60, "ExpRate": 1}`), 0644)
+
+	// 命令行参数在每次重新加载后仍然生效
+	loader := conf.Loader{
+		Files:   []string{file},
+		FlagSet: flag.NewFlagSet("demo", flag.ContinueOnError),
+		Args:    []string{"-max-level", "99"},
+	}
+	src, err := hotconf.New[Tuning]("tuning", loader, 0)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer src.Close()
+	fmt.Println(src.Get().ExpRate, src.Get().MaxLevel)
+
+	os.WriteFile(file, []byte(`{"MaxLevel": 70, "ExpRate": 2}`), 0644)
+	fmt.Println(src.Reload())
+	fmt.Println(src.Get().ExpRate, src.Get().MaxLevel)
+
+	// 配置不能重名
+	_, err = hotconf.New[Tuning]("tuning", conf.Loader{Files: []string{file}}, 0)
+	fmt.Println(err)
+
+	// Output:
+	// 1 99
+	// <nil>
+	// 2 99
+	// config tuning already exists
+}
@@ -0,0 +1,243 @@
+package hotconf
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/skeletongo/leaf.v1/chanrpc"
+	"github.com/skeletongo/leaf.v1/conf"
+	"github.com/skeletongo/leaf.v1/console"
+	"github.com/skeletongo/leaf.v1/log"
+)
+
+// Source 可以热加载的配置
+// 每次加载生成新的配置结构体，加载和校验(conf.Loader 的 required 标签及 conf.Validator)都成功后才替换，
+// 已经取得的旧配置不会被修改，读取时不需要加锁
+type Source[T any] struct {
+	name     string
+	loader   conf.Loader
+	cur      atomic.Pointer[T]
+	mu       sync.Mutex // 串行化加载
+	subs     []subscriber
+	modTimes map[string]time.Time // 上一次加载时配置文件的修改时间
+	closeSig chan struct{}
+}
+
+type subscriber struct {
+	server *chanrpc.Server
+	id     interface{}
+}
+
+// New 加载配置，name 用于 console 的 reload 命令，不能与其它配置重名
+// loader 设置了 FlagSet 时，每次重新加载都重新应用命令行参数，FlagSet 不能再用于其它 conf.Loader
+// interval 大于 0 时按此间隔检查配置文件的修改时间，修改后自动重新加载
+func New[T any](name string, loader conf.Loader, interval time.Duration) (*Source[T], error) {
+	s := &Source[T]{
+		name:     name,
+		loader:   loader,
+		closeSig: make(chan struct{}),
+	}
+	s.modTimes = s.stat()
+	v, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	s.cur.Store(v)
+
+	if err := add(s); err != nil {
+		return nil, err
+	}
+	if interval > 0 {
+		go s.watch(interval)
+	}
+	return s, nil
+}
+
+// Get 当前的配置，不能修改
+// 线程安全
+func (s *Source[T]) Get() *T {
+	return s.cur.Load()
+}
+
+// Subscribe 在模块的 ChanRPCServer 上订阅配置变更，f 在模块协程中执行，参数为变更前后的配置
+// 线程安全
+func (s *Source[T]) Subscribe(server *chanrpc.Server, id interface{}, f func(old, new *T)) {
+	server.Register(id, func(args []interface{}) {
+		f(args[0].(*T), args[1].(*T))
+	})
+
+	s.mu.Lock()
+	s.subs = append(s.subs, subscriber{server: server, id: id})
+	s.mu.Unlock()
+}
+
+// Reload 重新加载配置，加载或者校验失败时保持当前配置并返回错误
+// 成功后通知所有订阅者，订阅者的队列已满时可能阻塞，此时不影响 Get 和 Subscribe
+// 线程安全
+func (s *Source[T]) Reload() error {
+	s.mu.Lock()
+	// 手动加载后 watch 不再重复加载同样的修改
+	s.modTimes = s.stat()
+	v, err := s.load()
+	if err != nil {
+		s.mu.Unlock()
+		return err
+	}
+	old := s.cur.Swap(v)
+	subs := append([]subscriber(nil), s.subs...)
+	s.mu.Unlock()
+
+	for _, sub := range subs {
+		sub.server.Go(sub.id, old, v)
+	}
+	log.Release("config %v reloaded", s.name)
+	return nil
+}
+
+// Close 停止监视配置文件
+func (s *Source[T]) Close() {
+	select {
+	case <-s.closeSig:
+		return
+	default:
+	}
+	close(s.closeSig)
+	remove(s)
+}
+
+func (s *Source[T]) load() (*T, error) {
+	v := new(T)
+	if err := s.loader.Load(v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+func (s *Source[T]) stat() map[string]time.Time {
+	modTimes := make(map[string]time.Time, len(s.loader.Files))
+	for _, file := range s.loader.Files {
+		if fi, err := os.Stat(file); err == nil {
+			modTimes[file] = fi.ModTime()
+		}
+	}
+	return modTimes
+}
+
+func (s *Source[T]) watch(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.closeSig:
+			return
+		case <-ticker.C:
+		}
+
+		if !s.changed() {
+			continue
+		}
+		if err := s.Reload(); err != nil {
+			log.Error("config %v reload: %v", s.name, err)
+		}
+	}
+}
+
+// 配置文件在上一次加载之后是否有修改
+func (s *Source[T]) changed() bool {
+	modTimes := s.stat()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(modTimes) != len(s.modTimes) {
+		return true
+	}
+	for file, t := range modTimes {
+		if !t.Equal(s.modTimes[file]) {
+			return true
+		}
+	}
+	return false
+}
+
+// 所有配置，用于 console 的 reload 命令
+type reloader interface {
+	Reload() error
+	sourceName() string
+}
+
+var (
+	muSources sync.Mutex
+	sources   = make(map[string]reloader)
+	names     []string
+)
+
+func init() {
+	console.RegisterFunc("reload", "reload config, usage: reload [name]", commandReload)
+}
+
+func add(r reloader) error {
+	muSources.Lock()
+	defer muSources.Unlock()
+	name := r.sourceName()
+	if _, ok := sources[name]; ok {
+		return fmt.Errorf("config %v already exists", name)
+	}
+	names = append(names, name)
+	sources[name] = r
+	return nil
+}
+
+func remove(r reloader) {
+	muSources.Lock()
+	defer muSources.Unlock()
+	name := r.sourceName()
+	delete(sources, name)
+	for i, v := range names {
+		if v == name {
+			names = append(names[:i], names[i+1:]...)
+			break
+		}
+	}
+}
+
+func (s *Source[T]) sourceName() string {
+	return s.name
+}
+
+func commandReload(args []string) string {
+	muSources.Lock()
+	var targets []string
+	if len(args) > 0 {
+		targets = args
+	} else {
+		targets = append(targets, names...)
+	}
+	rs := make([]reloader, len(targets))
+	for i, name := range targets {
+		rs[i] = sources[name]
+	}
+	muSources.Unlock()
+
+	if len(targets) == 0 {
+		return "no config to reload"
+	}
+	var output []string
+	for i, name := range targets {
+		var err error
+		if rs[i] == nil {
+			err = errors.New("not found")
+		} else {
+			err = rs[i].Reload()
+		}
+		if err != nil {
+			output = append(output, fmt.Sprintf("%v: %v", name, err))
+		} else {
+			output = append(output, fmt.Sprintf("%v: reloaded", name))
+		}
+	}
+	return strings.Join(output, "\r\n")
+}
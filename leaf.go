@@ -1,41 +1,69 @@
 package leaf
 
 import (
+	"fmt"
 	"os"
 	"os/signal"
+	"syscall"
 
-	"github.com/skeletongo/leaf.v1/cluster"
 	"github.com/skeletongo/leaf.v1/conf"
-	"github.com/skeletongo/leaf.v1/console"
 	"github.com/skeletongo/leaf.v1/log"
 	"github.com/skeletongo/leaf.v1/module"
 )
 
+var shutdown = make(chan string, 1)
+
+// Shutdown 通知 Run 启动的实例关闭，reason 为关闭原因，记录到日志
+// 线程安全，可以多次调用，只有第一次生效
+func Shutdown(reason string) {
+	select {
+	case shutdown <- reason:
+	default:
+	}
+}
+
+// Run 按 conf 中的配置启动 Leaf，收到 SIGINT、SIGTERM、SIGHUP 或者调用 Shutdown 后关闭
+// 关闭过程中再次收到信号时立即退出
+// 模块初始化失败时销毁已经初始化的模块，以非零状态码退出
 func Run(modules ...module.Module) {
+	app := NewApp(DefaultConfig())
 	if conf.LogLevel != "" {
 		l, err := log.New(conf.LogLevel, conf.LogPath, conf.LogFlag)
 		if err != nil {
 			panic(err)
 		}
 		log.Export(l)
+		app.Logger = l
 		defer l.Close()
 	}
 
-	log.Release("Leaf %v starting up", version)
-
-	for i := 0; i < len(modules); i++ {
-		module.Register(modules[i])
+	app.Register(modules...)
+	if err := app.Start(); err != nil {
+		if app.Logger != nil {
+			app.Logger.Close()
+		}
+		os.Exit(1)
 	}
-	module.Init()
-	cluster.Init()
-	console.Init()
 
 	c := make(chan os.Signal, 1)
-	signal.Notify(c, os.Interrupt, os.Kill)
-	sig := <-c
-	log.Release("Leaf closing down (signal: %v)", sig)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+	// 关闭也可能由控制台命令或者模块失败直接通过 app.Shutdown 发起
+	closing := make(chan struct{})
+	go func() {
+		select {
+		case sig := <-c:
+			app.Shutdown(fmt.Sprintf("signal: %v", sig))
+		case reason := <-shutdown:
+			app.Shutdown(reason)
+		case <-closing:
+		}
+		sig := <-c
+		log.Error("Leaf forced to exit (signal: %v)", sig)
+		os.Exit(1)
+	}()
 
-	console.Destroy()
-	cluster.Destroy()
-	module.Destroy()
+	reason := app.Wait()
+	close(closing)
+	log.Release("Leaf closing down (%v)", reason)
+	app.Stop()
 }
@@ -0,0 +1,118 @@
+package module
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/skeletongo/leaf.v1/log"
+)
+
+// Named 可选接口，模块名，用于声明依赖和启动报告，同一个 Manager 中不能重复
+// 未实现时模块名为模块的类型名，同类型的模块依次加上 #2、#3 等后缀
+type Named interface {
+	ModuleName() string
+}
+
+// Depender 可选接口，声明依赖的模块名
+// 依赖的模块先初始化、后销毁
+type Depender interface {
+	DependsOn() []string
+}
+
+func moduleName(mi Module) string {
+	if n, ok := mi.(Named); ok {
+		return n.ModuleName()
+	}
+	return fmt.Sprintf("%T", mi)
+}
+
+func moduleDeps(mi Module) []string {
+	if d, ok := mi.(Depender); ok {
+		return d.DependsOn()
+	}
+	return nil
+}
+
+// 按依赖关系排序，没有依赖关系的模块保持注册顺序
+func sortModules(mods []*module) ([]*module, error) {
+	index := make(map[string]int, len(mods))
+	for i, m := range mods {
+		if _, ok := index[m.name]; ok {
+			return nil, fmt.Errorf("module %v is already registered", m.name)
+		}
+		index[m.name] = i
+	}
+	for _, m := range mods {
+		for _, dep := range m.deps {
+			if _, ok := index[dep]; !ok {
+				return nil, fmt.Errorf("module %v depends on unregistered module %v", m.name, dep)
+			}
+		}
+	}
+
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make([]int, len(mods))
+	sorted := make([]*module, 0, len(mods))
+	var path []string
+
+	var visit func(i int) error
+	visit = func(i int) error {
+		m := mods[i]
+		switch state[i] {
+		case visited:
+			return nil
+		case visiting:
+			// 从环的起点开始打印
+			for j, name := range path {
+				if name == m.name {
+					path = append(path[j:], m.name)
+					break
+				}
+			}
+			return fmt.Errorf("module dependency cycle: %v", strings.Join(path, " -> "))
+		}
+
+		state[i] = visiting
+		path = append(path, m.name)
+		for _, dep := range m.deps {
+			if err := visit(index[dep]); err != nil {
+				return err
+			}
+		}
+		path = path[:len(path)-1]
+		state[i] = visited
+		sorted = append(sorted, m)
+		return nil
+	}
+
+	for i := range mods {
+		if err := visit(i); err != nil {
+			return nil, err
+		}
+	}
+	return sorted, nil
+}
+
+// 打印启动报告：模块初始化顺序、耗时及依赖
+func report(mods []*module, total time.Duration) {
+	width := 0
+	for _, m := range mods {
+		if len(m.name) > width {
+			width = len(m.name)
+		}
+	}
+
+	log.Release("%v modules initialized in %v", len(mods), total)
+	for i, m := range mods {
+		line := fmt.Sprintf("%2d. %-*s %v", i+1, width, m.name, m.initTime)
+		if len(m.deps) > 0 {
+			line += fmt.Sprintf(" (depends on %v)", strings.Join(m.deps, ", "))
+		}
+		log.Release("%v", line)
+	}
+}
@@ -0,0 +1,271 @@
+package module
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/skeletongo/leaf.v1/chanrpc"
+)
+
+type service struct {
+	name string
+	deps []string
+}
+
+func (s *service) ModuleName() string         { return s.name }
+func (s *service) DependsOn() []string        { return s.deps }
+func (s *service) OnInit()                    { fmt.Println("init", s.name) }
+func (s *service) OnDestroy()                 { fmt.Println("destroy", s.name) }
+func (s *service) Run(closeSig chan struct{}) { <-closeSig }
+
+type plain struct{}
+
+func (p *plain) OnInit()                    {}
+func (p *plain) OnDestroy()                 {}
+func (p *plain) Run(closeSig chan struct{}) { <-closeSig }
+
+func ExampleManager() {
+	// 依赖的模块先初始化、后销毁，没有依赖关系的模块保持注册顺序
+	mgr := new(Manager)
+	mgr.Register(&service{name: "gate", deps: []string{"game"}})
+	mgr.Register(&service{name: "game", deps: []string{"db"}})
+	mgr.Register(&service{name: "db"})
+	mgr.Register(&service{name: "login"})
+	if err := mgr.Init(); err != nil {
+		fmt.Println(err)
+	}
+	mgr.Destroy()
+
+	// 依赖缺失
+	mgr = new(Manager)
+	mgr.Register(&service{name: "game", deps: []string{"db"}})
+	fmt.Println(mgr.Init())
+
+	// 循环依赖
+	mgr = new(Manager)
+	mgr.Register(&service{name: "a", deps: []string{"b"}})
+	mgr.Register(&service{name: "b", deps: []string{"c"}})
+	mgr.Register(&service{name: "c", deps: []string{"b"}})
+	fmt.Println(mgr.Init())
+
+	// 重复的模块名
+	mgr = new(Manager)
+	mgr.Register(&service{name: "db"})
+	mgr.Register(&service{name: "db"})
+	fmt.Println(mgr.Init())
+
+	// 未实现 Named 的同类型模块自动编号
+	mgr = new(Manager)
+	mgr.Register(&plain{})
+	mgr.Register(&plain{})
+	if err := mgr.Init(); err != nil {
+		fmt.Println(err)
+	}
+	for _, s := range mgr.Status() {
+		fmt.Println(s.Name, s.State)
+	}
+	mgr.Destroy()
+
+	// Output:
+	// init db
+	// init game
+	// init gate
+	// init login
+	// destroy login
+	// destroy gate
+	// destroy game
+	// destroy db
+	// module game depends on unregistered module db
+	// module dependency cycle: b -> c -> b
+	// module db is already registered
+	// *module.plain running
+	// *module.plain#2 running
+}
+
+func ExampleManager_Destroy() {
+	mgr := new(Manager)
+	mgr.Register(&service{name: "game"})
+
+	// Destroy 之后已注册的模块保留，再次 Init 时重新初始化并启动
+	for i := 0; i < 2; i++ {
+		if err := mgr.Init(); err != nil {
+			fmt.Println(err)
+		}
+		fmt.Println(mgr.Status()[0].State)
+		mgr.Destroy()
+	}
+
+	// Output:
+	// init game
+	// running
+	// destroy game
+	// init game
+	// running
+	// destroy game
+}
+
+func ExampleManager_Start() {
+	mgr := new(Manager)
+	mgr.Register(&service{name: "game"})
+
+	// Init 之前或者 Destroy 之后不能运行时启动模块
+	fmt.Println(mgr.Start(&service{name: "chat"}))
+
+	if err := mgr.Init(); err != nil {
+		fmt.Println(err)
+	}
+	fmt.Println(mgr.Start(&service{name: "chat", deps: []string{"game"}}))
+	for _, s := range mgr.Status() {
+		fmt.Println(s.Name, s.State)
+	}
+	mgr.Destroy()
+	fmt.Println(mgr.Start(&service{name: "chat"}))
+
+	// Output:
+	// modules not initialized
+	// init game
+	// init chat
+	// <nil>
+	// game running
+	// chat running
+	// destroy chat
+	// destroy game
+	// modules not initialized
+}
+
+type counter struct {
+	*Skeleton
+	n int
+}
+
+func (c *counter) ModuleName() string { return "counter" }
+func (c *counter) OnInit()            {}
+func (c *counter) OnDestroy()         {}
+
+func ExampleSkeleton_Run() {
+	c := &counter{Skeleton: &Skeleton{ChanRPCServer: chanrpc.NewServer(10)}}
+	c.Init()
+	c.RegisterChanRPC("add", func(args []interface{}) interface{} {
+		c.n += args[0].(int)
+		return c.n
+	})
+
+	// Destroy 之后再次 Init，Skeleton 重新打开 ChanRPCServer，已注册的方法保留
+	mgr := new(Manager)
+	mgr.Register(c)
+	for i := 0; i < 2; i++ {
+		if err := mgr.Init(); err != nil {
+			fmt.Println(err)
+		}
+		fmt.Println(c.ChanRPCServer.Call1("add", 1))
+		fmt.Println(mgr.Status()[0].State)
+		mgr.Destroy()
+	}
+
+	// Output:
+	// 1 <nil>
+	// running
+	// 2 <nil>
+	// running
+}
+
+// 前 panics 次 Run 抛异常，之后正常运行
+type flaky struct {
+	name   string
+	panics int
+	policy RestartPolicy
+	runs   int
+	ready  chan struct{}
+}
+
+func (f *flaky) ModuleName() string           { return f.name }
+func (f *flaky) RestartPolicy() RestartPolicy { return f.policy }
+func (f *flaky) OnInit()                      {}
+func (f *flaky) OnDestroy()                   {}
+
+func (f *flaky) Run(closeSig chan struct{}) {
+	f.runs++
+	if f.runs <= f.panics {
+		panic(fmt.Sprintf("run %v", f.runs))
+	}
+	close(f.ready)
+	<-closeSig
+}
+
+func ExampleRestartPolicy() {
+	// 重启：等待时间依次为 10ms、20ms、20ms
+	f := &flaky{
+		name:   "restart",
+		panics: 3,
+		policy: RestartPolicy{MaxRestarts: -1, Backoff: 10 * time.Millisecond, MaxBackoff: 20 * time.Millisecond},
+		ready:  make(chan struct{}),
+	}
+	mgr := new(Manager)
+	mgr.Register(f)
+	start := time.Now()
+	if err := mgr.Init(); err != nil {
+		fmt.Println(err)
+	}
+	<-f.ready
+	fmt.Println(time.Since(start) >= 50*time.Millisecond)
+	s := mgr.Status()[0]
+	fmt.Println(s.Name, s.State, s.Restarts, s.LastPanic)
+	mgr.Destroy()
+
+	// 超过重启次数后失败，调用 OnFail；默认不重启
+	for _, f := range []*flaky{
+		{name: "limited", panics: 3, policy: RestartPolicy{MaxRestarts: 1, Backoff: time.Millisecond}},
+		{name: "default", panics: 1},
+	} {
+		failed := make(chan string, 1)
+		mgr := new(Manager)
+		mgr.OnFail = func(name, reason string) {
+			failed <- name + ": " + reason
+		}
+		mgr.Register(f)
+		if err := mgr.Init(); err != nil {
+			fmt.Println(err)
+		}
+		fmt.Println("failed", <-failed)
+		s := mgr.Status()[0]
+		fmt.Println(s.Name, s.State, s.Restarts, s.LastPanic)
+		mgr.Destroy()
+	}
+
+	// Output:
+	// true
+	// restart running 3 run 3
+	// failed limited: run 2
+	// limited failed 1 run 2
+	// failed default: run 1
+	// default failed 0 run 1
+}
+
+func Example_tickerFire() {
+	start := time.Unix(0, 0)
+	now := start
+	t := &ticker{
+		interval: 10 * time.Millisecond,
+		next:     start.Add(10 * time.Millisecond),
+		timer:    time.NewTimer(time.Hour),
+		now:      func() time.Time { return now },
+	}
+	defer t.stop()
+
+	fire := func(at time.Duration) {
+		now = start.Add(at)
+		var ticks []uint64
+		t.fire(func(n uint64) { ticks = append(ticks, n) })
+		fmt.Println(at, ticks, "next", t.next.Sub(start))
+	}
+	fire(10 * time.Millisecond)  // 准时
+	fire(45 * time.Millisecond)  // 落后 3 个 tick，全部补齐
+	fire(200 * time.Millisecond) // 落后 16 个 tick，补齐 5 个后跳过 11 个
+	fire(210 * time.Millisecond)
+
+	// Output:
+	// 10ms [0] next 20ms
+	// 45ms [1 2 3] next 50ms
+	// 200ms [4 5 6 7 8] next 210ms
+	// 210ms [20] next 220ms
+}
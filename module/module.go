@@ -1,8 +1,11 @@
 package module
 
 import (
+	"fmt"
 	"runtime"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/skeletongo/leaf.v1/conf"
 	"github.com/skeletongo/leaf.v1/log"
@@ -17,48 +20,252 @@ type Module interface {
 
 type module struct {
 	mi       Module         // 模块
+	name     string         // 模块名
+	deps     []string       // 依赖的模块名
+	initTime time.Duration  // 初始化耗时
+	goid     atomic.Value   // 模块协程id，关闭超时时打印堆栈
 	closeSig chan struct{}  // 通知模块关闭
+	closing  int32          // 已经发送关闭信号，Run 抛异常时不再重启
 	wg       sync.WaitGroup // 模块启动标记
+	status   status         // 运行状态
 }
 
-var mods []*module
+// Initializer 可选接口，实现后代替 OnInit 调用
+// 返回错误时启动失败，已经初始化的模块按相反顺序销毁
+type Initializer interface {
+	OnInitE() error
+}
+
+// Destroyer 可选接口，实现后代替 OnDestroy 调用，返回的错误记录到日志
+type Destroyer interface {
+	OnDestroyE() error
+}
+
+// Manager 一组模块，负责模块的注册、初始化和关闭
+// 零值可以直接使用，一个进程中可以有多个 Manager
+type Manager struct {
+	ModuleCloseTimeout time.Duration // 单个模块关闭的超时时间，为 0 时不限制
+	CloseTimeout       time.Duration // 所有模块关闭的总超时时间，为 0 时不限制
+	RestartPolicy      RestartPolicy // 模块 Run 抛异常时的重启策略，模块实现 Restartable 时以模块的为准
+	// OnFail 模块 Run 抛异常且不再重启时调用，reason 为异常信息
+	// 在模块协程中调用，不能阻塞，leaf.App 通过它关闭整个实例
+	// 为 nil 时只有这个模块停止运行，其它模块调用它会一直得不到处理
+	OnFail func(name, reason string)
+
+	mu      sync.Mutex
+	mods    []*module
+	running bool // Init 成功后到 Destroy 之前
+}
+
+var std = new(Manager)
 
 // Register 模块注册
 func Register(mi Module) {
+	std.Register(mi)
+}
+
+// Init 模块初始化
+func Init() error {
+	return std.Init()
+}
+
+// Destroy 模块关闭，超时时间使用 conf.ModuleCloseTimeout、conf.CloseTimeout
+func Destroy() {
+	std.ModuleCloseTimeout = conf.ModuleCloseTimeout
+	std.CloseTimeout = conf.CloseTimeout
+	std.Destroy()
+}
+
+// Register 模块注册
+// 未实现 Named 的同类型模块依次命名为类型名、类型名#2、类型名#3...
+func (mgr *Manager) Register(mi Module) {
+	mgr.mu.Lock()
+	defer mgr.mu.Unlock()
+
+	m := newModule(mi)
+	mgr.rename(m)
+	mgr.mods = append(mgr.mods, m)
+}
+
+// 未实现 Named 的模块与已注册的模块重名时加上序号
+// 调用方需要加锁
+func (mgr *Manager) rename(m *module) {
+	if _, ok := m.mi.(Named); ok {
+		return
+	}
+	name := m.name
+	for n := 2; mgr.find(name) != nil; n++ {
+		name = fmt.Sprintf("%v#%v", m.name, n)
+	}
+	m.name = name
+}
+
+func newModule(mi Module) *module {
 	m := new(module)
 	m.mi = mi
+	m.name = moduleName(mi)
+	m.deps = moduleDeps(mi)
 	m.closeSig = make(chan struct{}, 1)
-	mods = append(mods, m)
+	return m
 }
 
-func Init() {
+// Init 模块初始化
+// 按依赖关系排序后依次初始化，依赖缺失、循环依赖或者模块初始化失败时返回错误
+// 初始化失败时已经初始化的模块按相反顺序销毁，不会启动任何模块
+// Destroy 之后可以再次调用，已注册的模块重新初始化并启动
+func (mgr *Manager) Init() error {
+	mgr.mu.Lock()
+	defer mgr.mu.Unlock()
+
+	if mgr.running {
+		return fmt.Errorf("modules already initialized")
+	}
+	mods, err := sortModules(mgr.mods)
+	if err != nil {
+		return err
+	}
+	mgr.mods = mods
+	for _, m := range mods {
+		m.reset()
+	}
+
+	start := time.Now()
 	for i := 0; i < len(mods); i++ {
-		mods[i].mi.OnInit()
+		t := time.Now()
+		if err := initModule(mods[i]); err != nil {
+			for j := i - 1; j >= 0; j-- {
+				destroy(mods[j])
+			}
+			return fmt.Errorf("module %v init: %w", mods[i].name, err)
+		}
+		mods[i].initTime = time.Since(t)
 	}
+	report(mods, time.Since(start))
+
 	// 模块初始化成功后再执行模块任务
-	var m *module
 	for i := 0; i < len(mods); i++ {
-		m = mods[i]
-		m.wg.Add(1) // 模块启动
-		go run(m)
+		mgr.start(mods[i])
 	}
+	mgr.running = true
+	addManager(mgr)
+	return nil
 }
 
-func run(m *module) {
-	// 模块启动时抛异常不处理，程序启动失败
-	m.mi.Run(m.closeSig)
-	m.wg.Done()
+// 嵌入 Skeleton 的模块，重新初始化前需要重新打开上一次 Run 关闭的服务
+type reopener interface {
+	reopen()
+}
+
+// 初始化时抛出的异常也作为初始化失败
+func initModule(m *module) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			if conf.LenStackBuf > 0 {
+				buf := make([]byte, conf.LenStackBuf)
+				l := runtime.Stack(buf, false)
+				log.Error("%v: %s", r, buf[:l])
+			}
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+
+	if r, ok := m.mi.(reopener); ok {
+		r.reopen()
+	}
+	if i, ok := m.mi.(Initializer); ok {
+		return i.OnInitE()
+	}
+	m.mi.OnInit()
+	return nil
 }
 
 // Destroy 模块关闭
-// 模块关闭的顺序和模块注册顺序相反
+// 模块关闭的顺序和模块初始化顺序相反
 // 模块启动后才能关闭，否则等待模块启动完成
-func Destroy() {
+// 模块协程超过 ModuleCloseTimeout 或者总时长超过 CloseTimeout 仍未退出时，
+// 打印模块协程的堆栈并跳过它的 OnDestroy，继续关闭其它模块
+// 已注册的模块保留，可以再次调用 Init 启动
+func (mgr *Manager) Destroy() {
+	var deadline time.Time
+	if mgr.CloseTimeout > 0 {
+		deadline = time.Now().Add(mgr.CloseTimeout)
+	}
+
+	mgr.mu.Lock()
+	if !mgr.running {
+		mgr.mu.Unlock()
+		return
+	}
+	mgr.running = false
+	mods := append([]*module(nil), mgr.mods...)
+	mgr.mu.Unlock()
+	removeManager(mgr)
+
 	for i := len(mods) - 1; i >= 0; i-- {
-		m := mods[i]
-		m.closeSig <- struct{}{} // 发送关闭信号
-		m.wg.Wait()              // 等待模块线程关闭
-		destroy(m)
+		timeout := mgr.ModuleCloseTimeout
+		if !deadline.IsZero() {
+			if remaining := time.Until(deadline); timeout <= 0 || remaining < timeout {
+				timeout = remaining
+			}
+		}
+		mods[i].stop(timeout, deadline.IsZero() && timeout <= 0)
+	}
+}
+
+// 清除上一次运行的状态
+func (m *module) reset() {
+	m.initTime = 0
+	m.goid.Store("")
+	m.closeSig = make(chan struct{}, 1)
+	atomic.StoreInt32(&m.closing, 0)
+	m.status.Lock()
+	m.status.state = ""
+	m.status.restarts = 0
+	m.status.lastPanic = ""
+	m.status.Unlock()
+}
+
+// 关闭模块，等待模块协程退出后销毁模块
+func (m *module) stop(timeout time.Duration, forever bool) {
+	atomic.StoreInt32(&m.closing, 1)
+	m.closeSig <- struct{}{}       // 发送关闭信号
+	if !m.wait(timeout, forever) { // 等待模块线程关闭
+		id, _ := m.goid.Load().(string)
+		log.Error("module %v did not stop within %v\n%s", m.name, timeout, stack(allStacks(), id))
+		return
+	}
+	destroy(m)
+}
+
+// 等待模块协程退出，forever 为 true 时不限时
+func (m *module) wait(timeout time.Duration, forever bool) bool {
+	if forever {
+		m.wg.Wait()
+		return true
+	}
+
+	done := make(chan struct{})
+	go func() {
+		m.wg.Wait()
+		close(done)
+	}()
+
+	if timeout < 0 {
+		timeout = 0
+	}
+	t := time.NewTimer(timeout)
+	defer t.Stop()
+	select {
+	case <-done:
+		return true
+	case <-t.C:
+		// 总时长已经用完时，已经退出的模块仍然正常关闭
+		select {
+		case <-done:
+			return true
+		default:
+			return false
+		}
 	}
 }
 
@@ -76,5 +283,11 @@ func destroy(m *module) {
 		}
 	}()
 
+	if d, ok := m.mi.(Destroyer); ok {
+		if err := d.OnDestroyE(); err != nil {
+			log.Error("module %v destroy: %v", m.name, err)
+		}
+		return
+	}
 	m.mi.OnDestroy()
 }
@@ -1,6 +1,8 @@
 package module
 
 import (
+	"context"
+	"fmt"
 	"time"
 
 	"github.com/skeletongo/leaf.v1/chanrpc"
@@ -8,9 +10,26 @@ import (
 	g "github.com/skeletongo/leaf.v1/go"
 	"github.com/skeletongo/leaf.v1/log"
 	"github.com/skeletongo/leaf.v1/timer"
+	"github.com/skeletongo/leaf.v1/trace"
 )
 
 type Skeleton struct {
+	// 模块名，不为空时登记模块的 ChanRPCServer 用于统计查询
+	Name string
+
+	// 单个任务(chanrpc 方法、定时器、Go 回调等)执行超过此时长时打印警告及模块协程的堆栈
+	// 为 0 时不检测
+	SlowThreshold time.Duration
+
+	// 固定频率的 tick 间隔，例如 50ms 即 20Hz，为 0 时不启用
+	// 每个 tick 在模块协程中调用 OnTick，n 为 tick 的序号，落后过多时跳过的 tick 序号不连续
+	TickInterval time.Duration
+	OnTick       func(n uint64)
+	// OnIdle 处理完所有待处理的任务、即将阻塞等待时在模块协程中调用
+	OnIdle func()
+	// OnBeforeClose 收到关闭信号后、关闭 ChanRPCServer 等之前在模块协程中调用
+	OnBeforeClose func()
+
 	// go
 	GoLen int
 	g     *g.Go
@@ -25,6 +44,10 @@ type Skeleton struct {
 
 	ChanRPCServer *chanrpc.Server
 	commandServer *chanrpc.Server
+	closed        bool // 上一次 Run 退出时关闭了 ChanRPCServer 等
+
+	w    *watchdog
+	span *trace.Span // 当前执行的任务所属的 span
 }
 
 func (s *Skeleton) Init() {
@@ -37,6 +60,9 @@ func (s *Skeleton) Init() {
 	if s.AsyncCallLen <= 0 {
 		s.AsyncCallLen = 0
 	}
+	if s.TickInterval > 0 && s.OnTick == nil {
+		panic("invalid OnTick")
+	}
 
 	s.g = g.New(s.GoLen)
 	s.dispatcher = timer.NewDispatcher(s.TimerDispatcherLen)
@@ -46,39 +72,172 @@ func (s *Skeleton) Init() {
 		s.ChanRPCServer = chanrpc.NewServer(100)
 	}
 	s.commandServer = chanrpc.NewServer(0)
+	if s.Name != "" {
+		chanrpc.Monitor(s.Name, s.ChanRPCServer, s.client)
+	}
 }
 
+// Run 模块协程的主循环，收到关闭信号后关闭 ChanRPCServer 等并返回
+// Manager Destroy 之后再次 Init 时，模块初始化前重新打开上一次关闭的服务，已注册的方法和命令保留
 func (s *Skeleton) Run(closeSig chan struct{}) {
+	name := s.Name
+	if name == "" {
+		name = "unnamed"
+	}
+	s.w = newWatchdog(name)
+	defer s.w.close()
+	if s.SlowThreshold > 0 {
+		watchdogClose := make(chan struct{})
+		defer close(watchdogClose)
+		go s.w.run(s.SlowThreshold, watchdogClose)
+	}
+
+	var t *ticker
+	if s.TickInterval > 0 {
+		t = newTicker(s.TickInterval)
+		defer t.stop()
+	}
+
 	for {
+		// 优先处理高优先级的调用
+		select {
+		case ci := <-s.ChanRPCServer.ChanCallHigh:
+			s.exec(s.ChanRPCServer, "chanrpc", ci)
+			continue
+		case ci := <-s.commandServer.ChanCallHigh:
+			s.exec(s.commandServer, "command", ci)
+			continue
+		default:
+		}
+
+		if s.OnIdle != nil && s.idle() {
+			s.w.begin("idle", nil)
+			safeCall(s.OnIdle)
+			s.w.end()
+		}
+
 		select {
 		case <-closeSig:
+			s.w.begin("close", nil)
+			if s.OnBeforeClose != nil {
+				safeCall(s.OnBeforeClose)
+			}
 			s.commandServer.Close()
 			s.ChanRPCServer.Close()
 			s.g.Close()
 			s.client.Close()
+			s.closed = true
+			s.w.end()
 			// dispatcher 没有关闭，可能会有定时器触发后往
 			// dispatcher.ChanTimer通道发消息，但没什么影响
 			return
+		case <-t.c():
+			t.fire(func(n uint64) {
+				s.w.begin("tick", nil)
+				safeCall(func() { s.OnTick(n) })
+				s.w.end()
+			})
 		case cb := <-s.g.ChanCb:
+			s.w.begin("go", nil)
 			s.g.Cb(cb)
+			s.w.end()
 		case t := <-s.dispatcher.ChanTimer:
+			s.w.begin("timer", nil)
 			t.Cb()
+			s.w.end()
 		case ri := <-s.client.ChanAsyncRet:
+			s.w.begin("async", nil)
+			s.span = ri.Span().Child("async callback")
 			s.client.Cb(ri)
+			s.span.End()
+			s.span = nil
+			s.w.end()
+		case ci := <-s.ChanRPCServer.ChanCallHigh:
+			s.exec(s.ChanRPCServer, "chanrpc", ci)
 		case ci := <-s.ChanRPCServer.ChanCall:
-			s.ChanRPCServer.Exec(ci)
+			s.exec(s.ChanRPCServer, "chanrpc", ci)
+		case ci := <-s.commandServer.ChanCallHigh:
+			s.exec(s.commandServer, "command", ci)
 		case ci := <-s.commandServer.ChanCall:
-			s.commandServer.Exec(ci)
+			s.exec(s.commandServer, "command", ci)
 		}
 	}
 }
 
+// 重新打开上一次 Run 关闭的服务
+func (s *Skeleton) reopen() {
+	if !s.closed {
+		return
+	}
+	s.ChanRPCServer.Reopen()
+	s.commandServer.Reopen()
+	if s.Name != "" {
+		chanrpc.Monitor(s.Name, s.ChanRPCServer, s.client)
+	}
+	s.closed = false
+}
+
+// 没有待处理的任务
+func (s *Skeleton) idle() bool {
+	return len(s.g.ChanCb) == 0 &&
+		len(s.dispatcher.ChanTimer) == 0 &&
+		len(s.client.ChanAsyncRet) == 0 &&
+		len(s.ChanRPCServer.ChanCallHigh) == 0 &&
+		len(s.ChanRPCServer.ChanCall) == 0 &&
+		len(s.commandServer.ChanCallHigh) == 0 &&
+		len(s.commandServer.ChanCall) == 0
+}
+
+func (s *Skeleton) exec(server *chanrpc.Server, kind string, ci *chanrpc.CallInfo) {
+	s.w.begin(kind, ci.ID())
+	s.span = ci.Span().Child(fmt.Sprint(kind, " ", ci.ID()))
+	server.Exec(ci)
+	s.span.End()
+	s.span = nil
+	s.w.end()
+}
+
+// 回调在模块协程中执行时延续注册回调时的链路
+func (s *Skeleton) traced(name string, cb func()) func() {
+	span := s.span
+	if span == nil || cb == nil {
+		return cb
+	}
+	return func() {
+		s.span = span.Child(name)
+		defer func() {
+			s.span.End()
+			s.span = nil
+		}()
+		cb()
+	}
+}
+
+// Span 模块协程当前执行的任务所属的 span，未开启追踪或者任务不在链路中时为 nil
+// 只能在模块协程中调用，可以用 Span().Release 等方法打印带链路信息的日志
+func (s *Skeleton) Span() *trace.Span {
+	return s.span
+}
+
+// Context 携带当前 span 的上下文，用于 GoContext、Call1Context 等调用向其它模块传递链路
+// 只能在模块协程中调用
+func (s *Skeleton) Context() context.Context {
+	return trace.NewContext(context.Background(), s.span)
+}
+
+func (s *Skeleton) withSpan(ctx context.Context) context.Context {
+	if s.span == nil || trace.FromContext(ctx) != nil {
+		return ctx
+	}
+	return trace.NewContext(ctx, s.span)
+}
+
 func (s *Skeleton) AfterFunc(d time.Duration, cb func()) *timer.Timer {
 	if s.TimerDispatcherLen <= 0 {
 		panic("invalid TimerDispatcherLen")
 	}
 
-	return s.dispatcher.AfterFunc(d, cb)
+	return s.dispatcher.AfterFunc(d, s.traced("timer", cb))
 }
 
 func (s *Skeleton) CronFunc(expr *timer.CronExpr, cb func()) *timer.Cron {
@@ -86,7 +245,7 @@ func (s *Skeleton) CronFunc(expr *timer.CronExpr, cb func()) *timer.Cron {
 		panic("invalid TimerDispatcherLen")
 	}
 
-	return s.dispatcher.CronFunc(expr, cb)
+	return s.dispatcher.CronFunc(expr, s.traced("cron", cb))
 }
 
 func (s *Skeleton) Go(f, cb func()) {
@@ -94,7 +253,7 @@ func (s *Skeleton) Go(f, cb func()) {
 		panic("invalid GoLen")
 	}
 
-	s.g.Go(f, cb)
+	s.g.Go(f, s.traced("go callback", cb))
 }
 
 func (s *Skeleton) NewLinearContext() *g.LinearContext {
@@ -111,9 +270,23 @@ func (s *Skeleton) AsyncCall(server *chanrpc.Server, id interface{}, args ...int
 	}
 
 	s.client.Attach(server)
+	if s.span != nil {
+		s.client.AsyncCallContext(s.Context(), id, args...)
+		return
+	}
 	s.client.AsyncCall(id, args...)
 }
 
+// AsyncCallContext 带上下文的异步调用，超时或者取消时回调在模块协程中收到错误
+func (s *Skeleton) AsyncCallContext(ctx context.Context, server *chanrpc.Server, id interface{}, args ...interface{}) {
+	if s.AsyncCallLen <= 0 {
+		panic("invalid AsyncCallLen")
+	}
+
+	s.client.Attach(server)
+	s.client.AsyncCallContext(s.withSpan(ctx), id, args...)
+}
+
 func (s *Skeleton) RegisterChanRPC(id, f interface{}) {
 	if s.ChanRPCServer == nil {
 		panic("invalid ChanRPCServer")
@@ -122,6 +295,68 @@ func (s *Skeleton) RegisterChanRPC(id, f interface{}) {
 	s.ChanRPCServer.Register(id, f)
 }
 
+// UnregisterChanRPC 注销消息处理方法
+func (s *Skeleton) UnregisterChanRPC(id interface{}) {
+	if s.ChanRPCServer == nil {
+		panic("invalid ChanRPCServer")
+	}
+
+	s.ChanRPCServer.Unregister(id)
+}
+
+// ReplaceChanRPC 替换消息处理方法，用于运行时热更新
+func (s *Skeleton) ReplaceChanRPC(id, f interface{}) {
+	if s.ChanRPCServer == nil {
+		panic("invalid ChanRPCServer")
+	}
+
+	s.ChanRPCServer.Replace(id, f)
+}
+
+// Subscribe 在模块的 ChanRPCServer 上订阅事件总线的主题
+func (s *Skeleton) Subscribe(bus *chanrpc.Bus, topic, f interface{}) {
+	if s.ChanRPCServer == nil {
+		panic("invalid ChanRPCServer")
+	}
+
+	bus.Subscribe(topic, s.ChanRPCServer, f)
+}
+
+// AsyncCallBus 异步扇出调用，所有订阅者返回或者超时后在模块协程中执行回调
+// 最后一个参数为回调 func([]*chanrpc.Result)
+func (s *Skeleton) AsyncCallBus(ctx context.Context, bus *chanrpc.Bus, topic interface{}, args ...interface{}) {
+	if len(args) < 1 {
+		panic("callback function not found")
+	}
+	cb, ok := args[len(args)-1].(func([]*chanrpc.Result))
+	if !ok {
+		panic("definition of callback function is invalid")
+	}
+	args = args[:len(args)-1]
+	ctx = s.withSpan(ctx)
+
+	var results []*chanrpc.Result
+	s.Go(func() {
+		results = bus.Call(ctx, topic, args...)
+	}, func() {
+		cb(results)
+	})
+}
+
 func (s *Skeleton) RegisterCommand(name, help string, f interface{}) {
 	console.Register(name, help, f, s.commandServer)
 }
+
+// AsyncCall 类型安全的异步调用，回调在模块协程中执行
+func AsyncCall[Req, Resp any](s *Skeleton, server *chanrpc.Server, id interface{}, req Req, cb func(Resp, error)) {
+	if s.AsyncCallLen <= 0 {
+		panic("invalid AsyncCallLen")
+	}
+
+	s.client.Attach(server)
+	if s.span != nil {
+		chanrpc.AsyncCallContext(s.Context(), s.client, id, req, cb)
+		return
+	}
+	chanrpc.AsyncCall(s.client, id, req, cb)
+}
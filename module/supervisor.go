@@ -0,0 +1,308 @@
+package module
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/skeletongo/leaf.v1/conf"
+	"github.com/skeletongo/leaf.v1/console"
+	"github.com/skeletongo/leaf.v1/log"
+)
+
+// RestartPolicy 模块 Run 抛异常时的重启策略
+// 重启只重新执行 Run，不重新初始化模块
+// 零值表示不重启，抛异常的模块停止运行并调用 Manager.OnFail
+type RestartPolicy struct {
+	MaxRestarts int           // 最多重启次数，为 0 时不重启，小于 0 时不限次数
+	Backoff     time.Duration // 第一次重启前的等待时间，之后每次翻倍，默认 1 秒
+	MaxBackoff  time.Duration // 等待时间上限，默认 1 分钟
+}
+
+// Restartable 可选接口，模块自己的重启策略
+type Restartable interface {
+	RestartPolicy() RestartPolicy
+}
+
+// 模块运行状态
+const (
+	stateRunning    = "running"
+	stateRestarting = "restarting"
+	stateStopped    = "stopped"
+	stateFailed     = "failed"
+)
+
+type status struct {
+	sync.Mutex
+	state     string
+	since     time.Time
+	restarts  int
+	lastPanic string
+}
+
+func (s *status) set(state string) {
+	s.Lock()
+	s.state = state
+	s.since = time.Now()
+	s.Unlock()
+}
+
+// Status 模块运行状态
+type Status struct {
+	Name      string
+	State     string // running、restarting、stopped、failed
+	Since     time.Time
+	Restarts  int    // 重启次数
+	LastPanic string // 最后一次抛出的异常
+}
+
+func (mgr *Manager) policy(m *module) RestartPolicy {
+	policy := mgr.RestartPolicy
+	if r, ok := m.mi.(Restartable); ok {
+		policy = r.RestartPolicy()
+	}
+	if policy.Backoff <= 0 {
+		policy.Backoff = time.Second
+	}
+	if policy.MaxBackoff <= 0 {
+		policy.MaxBackoff = time.Minute
+	}
+	return policy
+}
+
+func (mgr *Manager) start(m *module) {
+	m.status.set(stateRunning)
+	m.wg.Add(1) // 模块启动
+	go mgr.run(m)
+}
+
+// 执行模块任务，抛异常时按重启策略重启
+func (mgr *Manager) run(m *module) {
+	defer m.wg.Done()
+	m.goid.Store(goid())
+
+	policy := mgr.policy(m)
+	backoff := policy.Backoff
+	for {
+		panicked, r := runModule(m)
+		if !panicked || atomic.LoadInt32(&m.closing) == 1 {
+			m.status.set(stateStopped)
+			return
+		}
+
+		m.status.Lock()
+		m.status.lastPanic = r
+		restarts := m.status.restarts
+		m.status.Unlock()
+		if policy.MaxRestarts == 0 || policy.MaxRestarts > 0 && restarts >= policy.MaxRestarts {
+			log.Error("module %v failed after %v restarts", m.name, restarts)
+			m.status.set(stateFailed)
+			if mgr.OnFail != nil {
+				mgr.OnFail(m.name, r)
+			}
+			return
+		}
+
+		log.Release("module %v restarting in %v", m.name, backoff)
+		m.status.set(stateRestarting)
+		t := time.NewTimer(backoff)
+		select {
+		case <-m.closeSig:
+			t.Stop()
+			m.status.set(stateStopped)
+			return
+		case <-t.C:
+		}
+
+		backoff *= 2
+		if backoff > policy.MaxBackoff {
+			backoff = policy.MaxBackoff
+		}
+		m.status.Lock()
+		m.status.restarts++
+		m.status.Unlock()
+		m.status.set(stateRunning)
+	}
+}
+
+// 执行一次 Run，返回是否抛异常及异常信息
+func runModule(m *module) (panicked bool, reason string) {
+	defer func() {
+		if r := recover(); r != nil {
+			panicked, reason = true, fmt.Sprint(r)
+			if conf.LenStackBuf > 0 {
+				buf := make([]byte, conf.LenStackBuf)
+				l := runtime.Stack(buf, false)
+				log.Error("module %v: %v: %s", m.name, r, buf[:l])
+			} else {
+				log.Error("module %v: %v", m.name, r)
+			}
+		}
+	}()
+
+	m.mi.Run(m.closeSig)
+	return
+}
+
+// Start 运行时启动模块，模块依赖的模块必须已经启动
+// 只能在 Init 成功之后、Destroy 之前调用，否则返回错误
+// 线程安全
+func (mgr *Manager) Start(mi Module) error {
+	m := newModule(mi)
+
+	mgr.mu.Lock()
+	defer mgr.mu.Unlock()
+	if !mgr.running {
+		return fmt.Errorf("modules not initialized")
+	}
+	mgr.rename(m)
+	if mgr.find(m.name) != nil {
+		return fmt.Errorf("module %v is already registered", m.name)
+	}
+	for _, dep := range m.deps {
+		if mgr.find(dep) == nil {
+			return fmt.Errorf("module %v depends on unregistered module %v", m.name, dep)
+		}
+	}
+
+	if err := initModule(m); err != nil {
+		return fmt.Errorf("module %v init: %w", m.name, err)
+	}
+	mgr.mods = append(mgr.mods, m)
+	mgr.start(m)
+	log.Release("module %v started", m.name)
+	return nil
+}
+
+// Stop 运行时关闭模块，有其它模块依赖它时返回错误
+// 超时时间使用 ModuleCloseTimeout
+// 线程安全
+func (mgr *Manager) Stop(name string) error {
+	mgr.mu.Lock()
+	m := mgr.find(name)
+	if m == nil {
+		mgr.mu.Unlock()
+		return fmt.Errorf("module %v not found", name)
+	}
+	for _, other := range mgr.mods {
+		for _, dep := range other.deps {
+			if dep == name {
+				mgr.mu.Unlock()
+				return fmt.Errorf("module %v is required by %v", name, other.name)
+			}
+		}
+	}
+	for i, v := range mgr.mods {
+		if v == m {
+			mgr.mods = append(mgr.mods[:i], mgr.mods[i+1:]...)
+			break
+		}
+	}
+	mgr.mu.Unlock()
+
+	m.stop(mgr.ModuleCloseTimeout, mgr.ModuleCloseTimeout <= 0)
+	log.Release("module %v stopped", m.name)
+	return nil
+}
+
+// Status 所有模块的运行状态，按初始化顺序排列
+// 线程安全
+func (mgr *Manager) Status() []Status {
+	mgr.mu.Lock()
+	defer mgr.mu.Unlock()
+
+	ret := make([]Status, 0, len(mgr.mods))
+	for _, m := range mgr.mods {
+		m.status.Lock()
+		ret = append(ret, Status{
+			Name:      m.name,
+			State:     m.status.state,
+			Since:     m.status.since,
+			Restarts:  m.status.restarts,
+			LastPanic: m.status.lastPanic,
+		})
+		m.status.Unlock()
+	}
+	return ret
+}
+
+// 调用方需要加锁
+func (mgr *Manager) find(name string) *module {
+	for _, m := range mgr.mods {
+		if m.name == name {
+			return m
+		}
+	}
+	return nil
+}
+
+// 已经初始化的 Manager，用于 console 查询
+var (
+	muManagers sync.Mutex
+	managers   []*Manager
+)
+
+func init() {
+	console.RegisterFunc("module", "show module status or stop a module", commandModule)
+}
+
+func addManager(mgr *Manager) {
+	muManagers.Lock()
+	managers = append(managers, mgr)
+	muManagers.Unlock()
+}
+
+func removeManager(mgr *Manager) {
+	muManagers.Lock()
+	defer muManagers.Unlock()
+	for i, v := range managers {
+		if v == mgr {
+			managers = append(managers[:i], managers[i+1:]...)
+			return
+		}
+	}
+}
+
+func commandModule(args []string) string {
+	muManagers.Lock()
+	mgrs := append([]*Manager(nil), managers...)
+	muManagers.Unlock()
+
+	if len(args) == 0 {
+		var output []string
+		for _, mgr := range mgrs {
+			for _, s := range mgr.Status() {
+				line := fmt.Sprintf("%v - %v for %v, restarts: %v",
+					s.Name, s.State, time.Since(s.Since).Truncate(time.Second), s.Restarts)
+				if s.LastPanic != "" {
+					line += ", last panic: " + s.LastPanic
+				}
+				output = append(output, line)
+			}
+		}
+		if len(output) == 0 {
+			return "no module is running"
+		}
+		return strings.Join(output, "\r\n")
+	}
+
+	if args[0] != "stop" || len(args) != 2 {
+		return "Usage: module [stop name]"
+	}
+	for _, mgr := range mgrs {
+		mgr.mu.Lock()
+		m := mgr.find(args[1])
+		mgr.mu.Unlock()
+		if m == nil {
+			continue
+		}
+		if err := mgr.Stop(args[1]); err != nil {
+			return err.Error()
+		}
+		return ""
+	}
+	return fmt.Sprintf("module %v not found", args[1])
+}
@@ -0,0 +1,78 @@
+package module
+
+import (
+	"runtime"
+	"time"
+
+	"github.com/skeletongo/leaf.v1/conf"
+	"github.com/skeletongo/leaf.v1/log"
+)
+
+// 落后时一次最多补齐的 tick 数，超过时跳过落后的 tick
+const maxCatchUp = 5
+
+// 固定频率的 tick
+// 按开始时间计算每个 tick 的时间点，执行耗时和调度延迟不会累积
+type ticker struct {
+	interval time.Duration
+	next     time.Time // 下一个 tick 的时间点
+	n        uint64    // 下一个 tick 的序号
+	timer    *time.Timer
+	now      func() time.Time
+}
+
+func newTicker(interval time.Duration) *ticker {
+	return &ticker{
+		interval: interval,
+		next:     time.Now().Add(interval),
+		timer:    time.NewTimer(interval),
+		now:      time.Now,
+	}
+}
+
+func (t *ticker) c() <-chan time.Time {
+	if t == nil {
+		return nil
+	}
+	return t.timer.C
+}
+
+func (t *ticker) stop() {
+	if t != nil {
+		t.timer.Stop()
+	}
+}
+
+// 执行到期的 tick，然后设置下一个 tick 的时间点
+func (t *ticker) fire(f func(n uint64)) {
+	for i := 0; i < maxCatchUp && !t.now().Before(t.next); i++ {
+		f(t.n)
+		t.n++
+		t.next = t.next.Add(t.interval)
+	}
+
+	if now := t.now(); !now.Before(t.next) {
+		skipped := int64(now.Sub(t.next)/t.interval) + 1
+		t.n += uint64(skipped)
+		t.next = t.next.Add(time.Duration(skipped) * t.interval)
+		log.Debug("tick is falling behind, skipped %v ticks", skipped)
+	}
+	t.timer.Reset(t.next.Sub(t.now()))
+}
+
+// 执行回调，异常恢复
+func safeCall(f func()) {
+	defer func() {
+		if r := recover(); r != nil {
+			if conf.LenStackBuf > 0 {
+				buf := make([]byte, conf.LenStackBuf)
+				l := runtime.Stack(buf, false)
+				log.Error("%v: %s", r, buf[:l])
+			} else {
+				log.Error("%v", r)
+			}
+		}
+	}()
+
+	f()
+}
@@ -0,0 +1,200 @@
+package module
+
+import (
+	"bytes"
+	"fmt"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/skeletongo/leaf.v1/console"
+	"github.com/skeletongo/leaf.v1/log"
+)
+
+// 模块协程当前正在执行的任务
+type watchdog struct {
+	sync.Mutex
+	name   string
+	goid   string      // 模块协程id
+	kind   string      // 任务类型：chanrpc、command、timer、go、async
+	id     interface{} // chanrpc 方法id
+	start  time.Time   // 任务开始时间，为零值表示空闲
+	warned bool        // 是否已经打印过警告
+	dumped time.Time   // 上一次打印堆栈的时间
+}
+
+// 获取堆栈需要暂停所有协程，每个模块在此间隔内最多打印一次堆栈
+const stackInterval = time.Minute
+
+var (
+	muWatchdogs sync.Mutex
+	watchdogs   []*watchdog
+)
+
+func init() {
+	console.RegisterFunc("watchdog", "show what each module goroutine is executing", dumpWatchdogs)
+}
+
+func newWatchdog(name string) *watchdog {
+	w := &watchdog{name: name, goid: goid()}
+	muWatchdogs.Lock()
+	watchdogs = append(watchdogs, w)
+	muWatchdogs.Unlock()
+	return w
+}
+
+func (w *watchdog) close() {
+	muWatchdogs.Lock()
+	defer muWatchdogs.Unlock()
+	for i, v := range watchdogs {
+		if v == w {
+			watchdogs = append(watchdogs[:i], watchdogs[i+1:]...)
+			return
+		}
+	}
+}
+
+func (w *watchdog) begin(kind string, id interface{}) {
+	w.Lock()
+	w.kind = kind
+	w.id = id
+	w.start = time.Now()
+	w.warned = false
+	w.Unlock()
+}
+
+func (w *watchdog) end() {
+	w.Lock()
+	d := time.Since(w.start)
+	warned := w.warned
+	w.start = time.Time{}
+	w.Unlock()
+
+	if warned {
+		log.Release("module %v: %v finished after %v", w.name, w.task(), d)
+	}
+}
+
+// 调用方需要加锁
+func (w *watchdog) task() string {
+	if w.kind == "chanrpc" || w.kind == "command" {
+		return fmt.Sprintf("%v %v", w.kind, w.id)
+	}
+	return w.kind
+}
+
+// 执行超过 threshold 的任务打印警告及模块协程的堆栈，每个任务只打印一次
+// 堆栈按 stackInterval 限制频率，模块频繁出现慢任务时只打印警告
+func (w *watchdog) check(threshold time.Duration) {
+	w.Lock()
+	if w.start.IsZero() || w.warned {
+		w.Unlock()
+		return
+	}
+	d := time.Since(w.start)
+	if d < threshold {
+		w.Unlock()
+		return
+	}
+	w.warned = true
+	task := w.task()
+	dump := time.Since(w.dumped) >= stackInterval
+	if dump {
+		w.dumped = time.Now()
+	}
+	w.Unlock()
+
+	if !dump {
+		log.Error("module %v: %v has been running for %v", w.name, task, d)
+		return
+	}
+	log.Error("module %v: %v has been running for %v\n%s", w.name, task, d, stack(allStacks(), w.goid))
+}
+
+func (w *watchdog) run(threshold time.Duration, closeSig chan struct{}) {
+	interval := threshold / 2
+	if interval < 10*time.Millisecond {
+		interval = 10 * time.Millisecond
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-closeSig:
+			return
+		case <-ticker.C:
+			w.check(threshold)
+		}
+	}
+}
+
+func (w *watchdog) String() string {
+	w.Lock()
+	defer w.Unlock()
+	if w.start.IsZero() {
+		return w.name + " - idle"
+	}
+	return fmt.Sprintf("%v - %v, running for %v", w.name, w.task(), time.Since(w.start))
+}
+
+func dumpWatchdogs(args []string) string {
+	muWatchdogs.Lock()
+	ws := append([]*watchdog(nil), watchdogs...)
+	muWatchdogs.Unlock()
+
+	if len(ws) == 0 {
+		return "no module is running"
+	}
+	var stacks []byte
+	if len(args) > 0 && args[0] == "stack" {
+		stacks = allStacks()
+	}
+	var output []string
+	for _, w := range ws {
+		output = append(output, w.String())
+		if stacks != nil {
+			output = append(output, strings.ReplaceAll(string(stack(stacks, w.goid)), "\n", "\r\n"))
+		}
+	}
+	return strings.Join(output, "\r\n")
+}
+
+// 当前协程id
+func goid() string {
+	buf := make([]byte, 64)
+	buf = buf[:runtime.Stack(buf, false)]
+	// goroutine 18 [running]:
+	fields := bytes.Fields(buf)
+	if len(fields) < 2 {
+		return ""
+	}
+	if _, err := strconv.ParseUint(string(fields[1]), 10, 64); err != nil {
+		return ""
+	}
+	return string(fields[1])
+}
+
+// 所有协程的堆栈
+func allStacks() []byte {
+	buf := make([]byte, 1<<20)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			return buf[:n]
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+}
+
+// 从所有协程的堆栈中找出指定协程的堆栈
+func stack(stacks []byte, goid string) []byte {
+	head := []byte("goroutine " + goid + " [")
+	for _, g := range bytes.Split(stacks, []byte("\n\n")) {
+		if bytes.HasPrefix(g, head) {
+			return g
+		}
+	}
+	return nil
+}
@@ -2,6 +2,8 @@ package network
 
 import (
 	"net"
+	"net/http"
+	"net/url"
 )
 
 type Conn interface {
@@ -12,3 +14,11 @@ type Conn interface {
 	Close()
 	Destroy()
 }
+
+// ConnInfo 连接准入时可获取的连接信息
+type ConnInfo struct {
+	RemoteAddr net.Addr
+	ConnNum    int         // 当前连接数，不包括此连接
+	Header     http.Header // websocket 握手请求头，tcp 连接为 nil
+	Query      url.Values  // websocket 握手请求参数，tcp 连接为 nil
+}
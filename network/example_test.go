@@ -0,0 +1,96 @@
+package network
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net/http"
+)
+
+func proxyV2(cmd, family byte, addr []byte) []byte {
+	b := append([]byte(nil), proxyV2Sig...)
+	b = append(b, 0x20|cmd, family, 0, 0)
+	binary.BigEndian.PutUint16(b[len(b)-2:], uint16(len(addr)))
+	return append(b, addr...)
+}
+
+func Example_readProxyHeader() {
+	v4 := []byte{192, 168, 0, 1, 10, 0, 0, 1, 0x1F, 0x90, 0x00, 0x50}
+	v6 := make([]byte, 36)
+	v6[0], v6[1], v6[15] = 0x20, 0x01, 1
+	binary.BigEndian.PutUint16(v6[32:], 9000)
+
+	tests := []struct {
+		name   string
+		header []byte
+	}{
+		{"v1 tcp4", []byte("PROXY TCP4 192.168.0.1 10.0.0.1 8080 80\r\n")},
+		{"v1 tcp6", []byte("PROXY TCP6 2001:db8::1 ::1 9000 80\r\n")},
+		{"v1 unknown", []byte("PROXY UNKNOWN\r\n")},
+		{"v1 truncated", []byte("PROXY TCP4 192.168.0.1")},
+		{"v1 bad address", []byte("PROXY TCP4 999.0.0.1 10.0.0.1 8080 80\r\n")},
+		{"v1 too long", append([]byte("PROXY TCP4 "), bytes.Repeat([]byte("1"), 120)...)},
+		{"v2 tcp4", proxyV2(1, 0x11, v4)},
+		{"v2 tcp6", proxyV2(1, 0x21, v6)},
+		{"v2 local", proxyV2(0, 0x00, nil)},
+		{"v2 truncated", proxyV2(1, 0x11, v4)[:20]},
+		{"v2 short address", proxyV2(1, 0x11, v4[:8])},
+		{"no header", []byte("GET / HTTP/1.1\r\n\r\n")},
+	}
+	for _, tt := range tests {
+		addr, err := readProxyHeader(bytes.NewReader(tt.header))
+		fmt.Printf("%v: %v %v\n", tt.name, addr, err)
+	}
+
+	// Output:
+	// v1 tcp4: 192.168.0.1:8080 <nil>
+	// v1 tcp6: [2001:db8::1]:9000 <nil>
+	// v1 unknown: <nil> <nil>
+	// v1 truncated: <nil> EOF
+	// v1 bad address: <nil> invalid proxy protocol v1 source address: 999.0.0.1
+	// v1 too long: <nil> proxy protocol v1 header too long
+	// v2 tcp4: 192.168.0.1:8080 <nil>
+	// v2 tcp6: [2001::1]:9000 <nil>
+	// v2 local: <nil> <nil>
+	// v2 truncated: <nil> unexpected EOF
+	// v2 short address: <nil> proxy protocol v2 address too short
+	// no header: <nil> invalid proxy protocol header
+}
+
+func Example_forwardedAddr() {
+	nets, _ := parseTrustedProxies([]string{"10.0.0.1", "172.16.0.0/12"})
+
+	tests := []struct {
+		name   string
+		remote string
+		xff    string
+		realIP string
+	}{
+		{"direct", "1.2.3.4:5000", "", ""},
+		{"untrusted peer", "1.2.3.4:5000", "5.6.7.8", ""},
+		{"single proxy", "10.0.0.1:5000", "5.6.7.8", ""},
+		{"proxy chain", "10.0.0.1:5000", "5.6.7.8, 172.16.0.2", ""},
+		{"spoofed", "10.0.0.1:5000", "9.9.9.9, 5.6.7.8", ""},
+		{"unparseable", "10.0.0.1:5000", "5.6.7.8, unknown, 172.16.0.2", ""},
+		{"real ip", "10.0.0.1:5000", "", "5.6.7.8"},
+	}
+	for _, tt := range tests {
+		r := &http.Request{RemoteAddr: tt.remote, Header: http.Header{}}
+		if tt.xff != "" {
+			r.Header.Set("X-Forwarded-For", tt.xff)
+		}
+		if tt.realIP != "" {
+			r.Header.Set("X-Real-IP", tt.realIP)
+		}
+		fmt.Printf("%v: %v\n", tt.name, forwardedAddr(nets, r))
+	}
+
+	// Output:
+	// direct: <nil>
+	// untrusted peer: <nil>
+	// single proxy: 5.6.7.8:0
+	// proxy chain: 5.6.7.8:0
+	// spoofed: 5.6.7.8:0
+	// unparseable: <nil>
+	// real ip: 5.6.7.8:0
+}
@@ -1,6 +1,7 @@
 package json
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -128,6 +129,15 @@ func (p *Processor) Marshal(msg interface{}) ([][]byte, error) {
 }
 
 func (p *Processor) Route(msg interface{}, userData interface{}) error {
+	return p.route(nil, msg, userData)
+}
+
+// RouteContext 路由消息，ctx 随调用传给消息处理模块
+func (p *Processor) RouteContext(ctx context.Context, msg interface{}, userData interface{}) error {
+	return p.route(ctx, msg, userData)
+}
+
+func (p *Processor) route(ctx context.Context, msg interface{}, userData interface{}) error {
 	if msgRaw, ok := msg.(*MsgRaw); ok {
 		i, ok := p.msgInfo[msgRaw.msgID]
 		if !ok {
@@ -150,7 +160,11 @@ func (p *Processor) Route(msg interface{}, userData interface{}) error {
 		i.msgHandler([]interface{}{msg, userData})
 	}
 	if i.msgRouter != nil {
-		i.msgRouter.Go(msgType, msg, userData)
+		if ctx != nil {
+			i.msgRouter.GoContext(ctx, msgType, msg, userData)
+		} else {
+			i.msgRouter.Go(msgType, msg, userData)
+		}
 	}
 	return nil
 }
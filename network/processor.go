@@ -1,5 +1,9 @@
 package network
 
+import (
+	"context"
+)
+
 type Processor interface {
 	// must goroutine safe
 	Route(msg interface{}, userData interface{}) error
@@ -8,3 +12,10 @@ type Processor interface {
 	// must goroutine safe
 	Marshal(msg interface{}) ([][]byte, error)
 }
+
+// ContextProcessor 支持上下文的消息处理器，网关通过上下文向消息处理模块传递链路追踪等信息
+type ContextProcessor interface {
+	Processor
+	// must goroutine safe
+	RouteContext(ctx context.Context, msg interface{}, userData interface{}) error
+}
@@ -1,6 +1,7 @@
 package protobuf
 
 import (
+	"context"
 	"encoding/binary"
 	"errors"
 	"fmt"
@@ -131,6 +132,15 @@ func (p *Processor) Marshal(msg interface{}) ([][]byte, error) {
 }
 
 func (p *Processor) Router(msg interface{}, userData interface{}) error {
+	return p.route(nil, msg, userData)
+}
+
+// RouteContext 路由消息，ctx 随调用传给消息处理模块
+func (p *Processor) RouteContext(ctx context.Context, msg interface{}, userData interface{}) error {
+	return p.route(ctx, msg, userData)
+}
+
+func (p *Processor) route(ctx context.Context, msg interface{}, userData interface{}) error {
 	if msgRaw, ok := msg.(*MsgRaw); ok {
 		if msgRaw.msgID >= uint16(len(p.msgInfo)) {
 			return fmt.Errorf("message id %v not registered", msgRaw.msgID)
@@ -152,7 +162,11 @@ func (p *Processor) Router(msg interface{}, userData interface{}) error {
 		i.msgHandler([]interface{}{msg, userData})
 	}
 	if i.msgRouter != nil {
-		i.msgRouter.Go(msgType, msg, userData)
+		if ctx != nil {
+			i.msgRouter.GoContext(ctx, msgType, msg, userData)
+		} else {
+			i.msgRouter.Go(msgType, msg, userData)
+		}
 	}
 	return nil
 }
@@ -0,0 +1,176 @@
+package network
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// PROXY 协议 v2 签名
+var proxyV2Sig = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+// readProxyHeader 读取 HAProxy PROXY 协议头(v1/v2)，返回客户端真实地址
+// 返回 nil 地址表示 LOCAL 命令或者 UNKNOWN 协议族，此时应使用连接的对端地址
+func readProxyHeader(r io.Reader) (net.Addr, error) {
+	// v1 头最短 15 字节，v2 签名 12 字节，先读 12 字节用于区分版本
+	buf := make([]byte, 12, 107)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return nil, err
+	}
+	if bytes.Equal(buf, proxyV2Sig) {
+		return readProxyV2(r)
+	}
+	if bytes.HasPrefix(buf, []byte("PROXY ")) {
+		return readProxyV1(r, buf)
+	}
+	return nil, errors.New("invalid proxy protocol header")
+}
+
+// PROXY TCP4 255.255.255.255 255.255.255.255 65535 65535\r\n
+func readProxyV1(r io.Reader, buf []byte) (net.Addr, error) {
+	b := make([]byte, 1)
+	for !bytes.HasSuffix(buf, []byte("\r\n")) {
+		if len(buf) >= cap(buf) {
+			return nil, errors.New("proxy protocol v1 header too long")
+		}
+		if _, err := io.ReadFull(r, b); err != nil {
+			return nil, err
+		}
+		buf = append(buf, b[0])
+	}
+
+	fields := strings.Fields(string(buf))
+	if len(fields) < 2 {
+		return nil, errors.New("invalid proxy protocol v1 header")
+	}
+	switch fields[1] {
+	case "UNKNOWN":
+		return nil, nil
+	case "TCP4", "TCP6":
+	default:
+		return nil, errors.New("invalid proxy protocol v1 family: " + fields[1])
+	}
+	if len(fields) != 6 {
+		return nil, errors.New("invalid proxy protocol v1 header")
+	}
+	ip := net.ParseIP(fields[2])
+	if ip == nil {
+		return nil, errors.New("invalid proxy protocol v1 source address: " + fields[2])
+	}
+	port, err := strconv.ParseUint(fields[4], 10, 16)
+	if err != nil {
+		return nil, errors.New("invalid proxy protocol v1 source port: " + fields[4])
+	}
+	return &net.TCPAddr{IP: ip, Port: int(port)}, nil
+}
+
+func readProxyV2(r io.Reader) (net.Addr, error) {
+	head := make([]byte, 4)
+	if _, err := io.ReadFull(r, head); err != nil {
+		return nil, err
+	}
+	if head[0]>>4 != 2 {
+		return nil, errors.New("invalid proxy protocol v2 version")
+	}
+	data := make([]byte, binary.BigEndian.Uint16(head[2:]))
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, err
+	}
+
+	switch head[0] & 0x0F {
+	case 0: // LOCAL
+		return nil, nil
+	case 1: // PROXY
+	default:
+		return nil, errors.New("invalid proxy protocol v2 command")
+	}
+	switch head[1] {
+	case 0x11: // TCP over IPv4
+		if len(data) < 12 {
+			return nil, errors.New("proxy protocol v2 address too short")
+		}
+		return &net.TCPAddr{IP: net.IP(data[:4]), Port: int(binary.BigEndian.Uint16(data[8:]))}, nil
+	case 0x21: // TCP over IPv6
+		if len(data) < 36 {
+			return nil, errors.New("proxy protocol v2 address too short")
+		}
+		return &net.TCPAddr{IP: net.IP(data[:16]), Port: int(binary.BigEndian.Uint16(data[32:]))}, nil
+	}
+	return nil, nil
+}
+
+// 解析受信任的代理地址，支持 IP 和 CIDR
+func parseTrustedProxies(proxies []string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, v := range proxies {
+		if !strings.Contains(v, "/") {
+			ip := net.ParseIP(v)
+			if ip == nil {
+				return nil, errors.New("invalid trusted proxy: " + v)
+			}
+			bits := 8 * net.IPv6len
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 8*net.IPv4len
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(v)
+		if err != nil {
+			return nil, err
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+func trusted(nets []*net.IPNet, ip net.IP) bool {
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// forwardedAddr 对端为受信任的代理时，从 X-Forwarded-For 或 X-Real-IP 中取客户端真实地址
+// X-Forwarded-For 从右向左跳过受信任的代理，第一个不受信任的地址即客户端地址
+// 遇到无法解析的地址时不再信任其中的内容，使用连接的对端地址
+// 返回 nil 表示使用连接的对端地址
+func forwardedAddr(nets []*net.IPNet, r *http.Request) net.Addr {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return nil
+	}
+	peer := net.ParseIP(host)
+	if peer == nil || !trusted(nets, peer) {
+		return nil
+	}
+
+	var client net.IP
+	if xff := r.Header.Values("X-Forwarded-For"); len(xff) > 0 {
+		ips := strings.Split(strings.Join(xff, ","), ",")
+		for i := len(ips) - 1; i >= 0; i-- {
+			ip := net.ParseIP(strings.TrimSpace(ips[i]))
+			if ip == nil {
+				return nil
+			}
+			client = ip
+			if !trusted(nets, ip) {
+				break
+			}
+		}
+	}
+	if client == nil {
+		client = net.ParseIP(strings.TrimSpace(r.Header.Get("X-Real-IP")))
+	}
+	if client == nil {
+		return nil
+	}
+	return &net.TCPAddr{IP: client}
+}
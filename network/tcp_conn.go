@@ -6,10 +6,11 @@ import (
 )
 
 type TCPConn struct {
-	conn      net.Conn      // tcp链接
-	writeChan chan []byte   // 消息发送缓冲队列
-	closeFlag chan struct{} // 关闭标志
-	pkgParser *PkgParser    // 封包拆包规则
+	conn       net.Conn      // tcp链接
+	remoteAddr net.Addr      // 客户端真实地址，经过代理时由 PROXY 协议头得到
+	writeChan  chan []byte   // 消息发送缓冲队列
+	closeFlag  chan struct{} // 关闭标志
+	pkgParser  *PkgParser    // 封包拆包规则
 }
 
 func newTCPConn(conn net.Conn, l int, pkgParser *PkgParser) *TCPConn {
@@ -63,6 +64,9 @@ func (c *TCPConn) LocalAddr() net.Addr {
 }
 
 func (c *TCPConn) RemoteAddr() net.Addr {
+	if c.remoteAddr != nil {
+		return c.remoteAddr
+	}
 	return c.conn.RemoteAddr()
 }
 
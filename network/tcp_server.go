@@ -8,12 +8,16 @@ import (
 	"github.com/skeletongo/leaf.v1/log"
 )
 
+// 读取 PROXY 协议头的超时时间
+const proxyHeaderTimeout = 5 * time.Second
+
 type TCPServer struct {
 	sync.Mutex
 	Addr            string // 服务地址
 	MaxConnNum      int    // 最大连接数
 	PendingWriteNum int    // 消息发送队列缓冲区长度
 	NewAgent        func(conn *TCPConn) Agent
+	ProxyProtocol   bool // 连接由负载均衡转发，开启后每个连接必须以 PROXY 协议头(v1/v2)开始
 	ln              net.Listener
 	connMap         map[net.Conn]struct{}
 	wgLn            sync.WaitGroup
@@ -25,6 +29,11 @@ type TCPServer struct {
 	MaxPkgLen    uint32
 	LittleEndian bool
 	pkgParser    *PkgParser
+
+	// Admit 连接准入，在连接协程中调用，可以阻塞(例如排队)
+	// 返回 false 时关闭连接，关闭前可以通过 conn 向客户端发送拒绝原因
+	// 设置后不再按 MaxConnNum 限制连接数，由 Admit 自行判断
+	Admit func(conn Conn, info *ConnInfo) bool
 }
 
 func (s *TCPServer) Start() {
@@ -82,7 +91,8 @@ func (s *TCPServer) run() {
 		}
 		tempDelay = 0
 		s.Lock()
-		if len(s.connMap) >= s.MaxConnNum {
+		connNum := len(s.connMap)
+		if s.Admit == nil && connNum >= s.MaxConnNum {
 			s.Unlock()
 			_ = conn.Close()
 			log.Error("too many connections")
@@ -94,8 +104,31 @@ func (s *TCPServer) run() {
 		s.wgConn.Add(1)
 
 		tcpConn := newTCPConn(conn, s.PendingWriteNum, s.pkgParser)
-		agent := s.NewAgent(tcpConn)
 		go func() {
+			if s.ProxyProtocol {
+				_ = conn.SetReadDeadline(time.Now().Add(proxyHeaderTimeout))
+				addr, err := readProxyHeader(conn)
+				if err != nil {
+					log.Debug("read proxy header error: %v", err)
+					tcpConn.Destroy()
+					s.Lock()
+					delete(s.connMap, conn)
+					s.Unlock()
+					s.wgConn.Done()
+					return
+				}
+				_ = conn.SetReadDeadline(time.Time{})
+				tcpConn.remoteAddr = addr
+			}
+			if s.Admit != nil && !s.Admit(tcpConn, &ConnInfo{RemoteAddr: tcpConn.RemoteAddr(), ConnNum: connNum}) {
+				tcpConn.Close()
+				s.Lock()
+				delete(s.connMap, conn)
+				s.Unlock()
+				s.wgConn.Done()
+				return
+			}
+			agent := s.NewAgent(tcpConn)
 			agent.Run()
 			tcpConn.Close()
 			s.Lock()
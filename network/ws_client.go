@@ -16,6 +16,8 @@ type WSClient struct {
 	PendingWriteNum  int
 	MaxPkgLen        uint32
 	HandshakeTimeout time.Duration
+	Subprotocols     []string  // 请求的子协议，按优先级排列
+	FrameType        FrameType // 发送消息使用的帧类型，默认为二进制帧
 	AutoReconnect    bool
 	NewAgent         func(*WSConn) Agent
 	dialer           websocket.Dialer
@@ -61,6 +63,7 @@ func (c *WSClient) init() {
 	c.connMap = make(map[*websocket.Conn]struct{})
 	c.dialer = websocket.Dialer{
 		HandshakeTimeout: c.HandshakeTimeout,
+		Subprotocols:     c.Subprotocols,
 	}
 }
 
@@ -93,7 +96,7 @@ here:
 	c.connMap[conn] = struct{}{}
 	c.Unlock()
 
-	wsConn := newWSConn(conn, c.PendingWriteNum, c.MaxPkgLen)
+	wsConn := newWSConn(conn, nil, c.PendingWriteNum, c.MaxPkgLen, c.FrameType)
 	agent := c.NewAgent(wsConn)
 	agent.Run()
 	wsConn.Close()
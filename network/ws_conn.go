@@ -3,32 +3,50 @@ package network
 import (
 	"errors"
 	"net"
+	"net/http"
+	"sync/atomic"
 
 	"github.com/gorilla/websocket"
 )
 
+// FrameType websocket 消息帧类型
+type FrameType int
+
+const (
+	FrameBinary FrameType = iota // 二进制帧
+	FrameText                    // 文本帧，json 消息可以直接在浏览器开发者工具中查看
+	FrameMirror                  // 与对端最近一次发送的帧类型相同，对端未发送过消息时使用二进制帧
+)
+
 type WebsocketConnSet map[*websocket.Conn]struct{}
 
 type WSConn struct {
 	conn      *websocket.Conn
+	req       *http.Request // 握手请求，客户端连接为 nil
+	addr      net.Addr      // 客户端真实地址，经过受信任的代理时由请求头得到
 	writeChan chan []byte
 	closeFlag chan struct{} // 关闭标志
 	maxPkgLen uint32
+	frameType FrameType
+	lastType  int32 // 对端最近一次发送的帧类型
 }
 
-func newWSConn(conn *websocket.Conn, pendingWriteNum int, maxPkgLen uint32) *WSConn {
+func newWSConn(conn *websocket.Conn, req *http.Request, pendingWriteNum int, maxPkgLen uint32, frameType FrameType) *WSConn {
 	c := new(WSConn)
 	c.conn = conn
+	c.req = req
 	c.writeChan = make(chan []byte, pendingWriteNum)
 	c.closeFlag = make(chan struct{})
 	c.maxPkgLen = maxPkgLen
+	c.frameType = frameType
+	c.lastType = websocket.BinaryMessage
 
 	go func() {
 		for b := range c.writeChan {
 			if b == nil {
 				break
 			}
-			err := conn.WriteMessage(websocket.BinaryMessage, b)
+			err := conn.WriteMessage(c.messageType(), b)
 			if err != nil {
 				break
 			}
@@ -82,11 +100,38 @@ func (c *WSConn) LocalAddr() net.Addr {
 }
 
 func (c *WSConn) RemoteAddr() net.Addr {
+	if c.addr != nil {
+		return c.addr
+	}
 	return c.conn.RemoteAddr()
 }
 
+// Request 握手请求，可以读取请求头、Cookie、请求参数等，客户端连接为 nil
+func (c *WSConn) Request() *http.Request {
+	return c.req
+}
+
+// Subprotocol 协商后的子协议
+func (c *WSConn) Subprotocol() string {
+	return c.conn.Subprotocol()
+}
+
+func (c *WSConn) messageType() int {
+	switch c.frameType {
+	case FrameText:
+		return websocket.TextMessage
+	case FrameMirror:
+		return int(atomic.LoadInt32(&c.lastType))
+	default:
+		return websocket.BinaryMessage
+	}
+}
+
 func (c *WSConn) ReadMsg() ([]byte, error) {
-	_, b, err := c.conn.ReadMessage()
+	t, b, err := c.conn.ReadMessage()
+	if err == nil && c.frameType == FrameMirror {
+		atomic.StoreInt32(&c.lastType, int32(t))
+	}
 	return b, err
 }
 
@@ -20,8 +20,20 @@ type WSServer struct {
 	CertFile        string
 	KeyFile         string
 	NewAgent        func(*WSConn) Agent
+	CheckOrigin     func(r *http.Request) bool // 来源检查，为 nil 时接受所有来源
+	Subprotocols    []string                   // 支持的子协议，按优先级排列
+	Auth            func(r *http.Request) int  // 握手鉴权，返回 http.StatusOK 以外的状态码时拒绝升级，不是有效的 HTTP 状态码时按 401 处理
+	TrustedProxies  []string                   // 受信任的代理(IP 或 CIDR)，来自它们的连接按 X-Forwarded-For/X-Real-IP 取客户端地址
+	Path            string                     // websocket 服务路径，默认为 "/"，即所有路径都升级为 websocket
+	Mux             *http.ServeMux             // 共用的路由，websocket 服务挂载到 Path 上，其它路径可以注册 HTTP 接口
+	FrameType       FrameType                  // 发送消息使用的帧类型，默认为二进制帧
 	ln              net.Listener
 	handler         *WSHandler
+
+	// Admit 连接准入，在连接协程中调用，可以阻塞(例如排队)
+	// 返回 false 时关闭连接，关闭前可以通过 conn 向客户端发送拒绝原因
+	// 设置后不再按 MaxConnNum 限制连接数，由 Admit 自行判断
+	Admit func(conn Conn, info *ConnInfo) bool
 }
 
 type WSHandler struct {
@@ -29,7 +41,11 @@ type WSHandler struct {
 	maxConnNum      int
 	pendingWriteNum int
 	maxPkgLen       uint32
+	frameType       FrameType
 	newAgent        func(*WSConn) Agent
+	admit           func(Conn, *ConnInfo) bool
+	auth            func(*http.Request) int
+	trustedProxies  []*net.IPNet
 	upgrade         websocket.Upgrader
 	connMap         map[*websocket.Conn]struct{}
 	wg              sync.WaitGroup
@@ -40,6 +56,15 @@ func (h *WSHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Method not allowed", 405)
 		return
 	}
+	if h.auth != nil {
+		if status := h.auth(r); status != http.StatusOK {
+			if status < 100 || status > 599 {
+				status = http.StatusUnauthorized
+			}
+			http.Error(w, http.StatusText(status), status)
+			return
+		}
+	}
 	conn, err := h.upgrade.Upgrade(w, r, nil)
 	if err != nil {
 		log.Debug("upgrade error: %v", err)
@@ -56,7 +81,8 @@ func (h *WSHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		_ = conn.Close()
 		return
 	}
-	if len(h.connMap) >= h.maxConnNum {
+	connNum := len(h.connMap)
+	if h.admit == nil && connNum >= h.maxConnNum {
 		h.Unlock()
 		_ = conn.Close()
 		log.Debug("too many connections")
@@ -65,7 +91,22 @@ func (h *WSHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	h.connMap[conn] = struct{}{}
 	h.Unlock()
 
-	wsConn := newWSConn(conn, h.pendingWriteNum, h.maxPkgLen)
+	wsConn := newWSConn(conn, r, h.pendingWriteNum, h.maxPkgLen, h.frameType)
+	if h.trustedProxies != nil {
+		wsConn.addr = forwardedAddr(h.trustedProxies, r)
+	}
+	if h.admit != nil && !h.admit(wsConn, &ConnInfo{
+		RemoteAddr: wsConn.RemoteAddr(),
+		ConnNum:    connNum,
+		Header:     r.Header,
+		Query:      r.URL.Query(),
+	}) {
+		wsConn.Close()
+		h.Lock()
+		delete(h.connMap, conn)
+		h.Unlock()
+		return
+	}
 	agent := h.newAgent(wsConn)
 	agent.Run()
 
@@ -77,10 +118,24 @@ func (h *WSHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	agent.OnClose()
 }
 
+// Start 启动服务
+// Addr 为空时不监听端口，Mux 不为 nil 时挂载到 Mux 上，否则需要把 Handler 挂载到调用方自己的 HTTP 服务上
 func (s *WSServer) Start() {
-	if s.NewAgent == nil {
-		log.Fatal("NewAgent must not be nil")
+	s.init()
+
+	var handler http.Handler = s.handler
+	if s.Mux != nil {
+		s.Mux.Handle(s.Path, s.handler)
+		handler = s.Mux
+	} else if s.Path != "/" {
+		mux := http.NewServeMux()
+		mux.Handle(s.Path, s.handler)
+		handler = mux
+	}
+	if s.Addr == "" {
+		return
 	}
+
 	ln, err := net.Listen("tcp", s.Addr)
 	if err != nil {
 		log.Fatal("%v", err)
@@ -98,6 +153,23 @@ func (s *WSServer) Start() {
 
 		ln = tls.NewListener(ln, config)
 	}
+	s.ln = ln
+
+	httpServer := &http.Server{
+		Addr:           s.Addr,
+		Handler:        handler,
+		ReadTimeout:    s.HTTPTimeout,
+		WriteTimeout:   s.HTTPTimeout,
+		MaxHeaderBytes: 1024,
+	}
+
+	go httpServer.Serve(ln)
+}
+
+func (s *WSServer) init() {
+	if s.NewAgent == nil {
+		log.Fatal("NewAgent must not be nil")
+	}
 	if s.MaxConnNum <= 0 {
 		s.MaxConnNum = 100
 		log.Release("invalid MaxConnNum, reset to %v", s.MaxConnNum)
@@ -114,33 +186,45 @@ func (s *WSServer) Start() {
 		s.HTTPTimeout = 10 * time.Second
 		log.Release("invalid HTTPTimeout, reset to %v", s.HTTPTimeout)
 	}
+	if s.Path == "" {
+		s.Path = "/"
+	}
+	if s.CheckOrigin == nil {
+		s.CheckOrigin = func(_ *http.Request) bool { return true }
+	}
+
+	trustedProxies, err := parseTrustedProxies(s.TrustedProxies)
+	if err != nil {
+		log.Fatal("%v", err)
+	}
 
-	s.ln = ln
 	s.handler = &WSHandler{
 		maxConnNum:      s.MaxConnNum,
 		pendingWriteNum: s.PendingWriteNum,
 		maxPkgLen:       s.MaxPkgLen,
+		frameType:       s.FrameType,
 		newAgent:        s.NewAgent,
+		admit:           s.Admit,
+		auth:            s.Auth,
+		trustedProxies:  trustedProxies,
 		connMap:         make(map[*websocket.Conn]struct{}),
 		upgrade: websocket.Upgrader{
 			HandshakeTimeout: s.HTTPTimeout,
-			CheckOrigin:      func(_ *http.Request) bool { return true },
+			CheckOrigin:      s.CheckOrigin,
+			Subprotocols:     s.Subprotocols,
 		},
 	}
+}
 
-	httpServer := &http.Server{
-		Addr:           s.Addr,
-		Handler:        s.handler,
-		ReadTimeout:    s.HTTPTimeout,
-		WriteTimeout:   s.HTTPTimeout,
-		MaxHeaderBytes: 1024,
-	}
-
-	go httpServer.Serve(ln)
+// Handler websocket 处理器，Start 之后才能获取，用于挂载到调用方自己的 HTTP 服务上
+func (s *WSServer) Handler() http.Handler {
+	return s.handler
 }
 
 func (s *WSServer) Close() {
-	_ = s.ln.Close()
+	if s.ln != nil {
+		_ = s.ln.Close()
+	}
 
 	s.handler.Lock()
 	for conn := range s.handler.connMap {
@@ -0,0 +1,45 @@
+package trace_test
+
+import (
+	"fmt"
+
+	"github.com/skeletongo/leaf.v1/trace"
+)
+
+type collector []*trace.Span
+
+func (c *collector) Export(span *trace.Span) {
+	*c = append(*c, span)
+}
+
+func Example() {
+	c := new(collector)
+	trace.SetExporter(c)
+	defer trace.SetExporter(nil)
+
+	root := trace.New("gate *msg.Hello")
+	child := root.Child("chanrpc *msg.Hello")
+	child.End()
+	root.End()
+
+	fmt.Println(len(*c))
+	fmt.Println((*c)[0].TraceID == (*c)[1].TraceID)
+	fmt.Println((*c)[0].ParentID == (*c)[1].SpanID)
+
+	parent, _ := trace.Parse(root.Traceparent())
+	fmt.Println(parent.Child("cluster").TraceID == root.TraceID)
+
+	// 未开启追踪时 span 为 nil，方法仍可调用
+	trace.SetExporter(nil)
+	span := trace.New("disabled")
+	span.SetAttr("key", "value")
+	span.End()
+	fmt.Println(span == nil, len(*c))
+
+	// Output:
+	// 2
+	// true
+	// true
+	// true
+	// true 2
+}
@@ -0,0 +1,137 @@
+package trace
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// WriterExporter 以 OTLP/JSON 格式导出，每个 span 一行
+// 可以写入本地文件，由 OpenTelemetry Collector 的 otlpjsonfile receiver 读取
+type WriterExporter struct {
+	mu          sync.Mutex
+	w           io.Writer
+	serviceName string
+}
+
+func NewWriterExporter(w io.Writer, serviceName string) *WriterExporter {
+	return &WriterExporter{w: w, serviceName: serviceName}
+}
+
+// FileExporter 导出到本地文件
+type FileExporter struct {
+	*WriterExporter
+	f *os.File
+}
+
+func NewFileExporter(filename string, serviceName string) (*FileExporter, error) {
+	f, err := os.OpenFile(filename, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &FileExporter{WriterExporter: NewWriterExporter(f, serviceName), f: f}, nil
+}
+
+func (e *FileExporter) Close() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.f.Close()
+}
+
+type otlpValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+}
+
+type otlpAttr struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpSpan struct {
+	TraceID           string     `json:"traceId"`
+	SpanID            string     `json:"spanId"`
+	ParentSpanID      string     `json:"parentSpanId,omitempty"`
+	Name              string     `json:"name"`
+	Kind              int        `json:"kind"`
+	StartTimeUnixNano string     `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string     `json:"endTimeUnixNano"`
+	Attributes        []otlpAttr `json:"attributes,omitempty"`
+	Status            otlpStatus `json:"status"`
+}
+
+func attr(key string, value interface{}) otlpAttr {
+	a := otlpAttr{Key: key}
+	switch v := value.(type) {
+	case bool:
+		a.Value.BoolValue = &v
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		s := fmt.Sprint(v)
+		a.Value.IntValue = &s
+	case float32:
+		f := float64(v)
+		a.Value.DoubleValue = &f
+	case float64:
+		a.Value.DoubleValue = &v
+	default:
+		s := fmt.Sprint(v)
+		a.Value.StringValue = &s
+	}
+	return a
+}
+
+func (e *WriterExporter) Export(span *Span) {
+	span.mu.Lock()
+	s := otlpSpan{
+		TraceID:           span.TraceID,
+		SpanID:            span.SpanID,
+		ParentSpanID:      span.ParentID,
+		Name:              span.Name,
+		Kind:              1, // SPAN_KIND_INTERNAL
+		StartTimeUnixNano: strconv.FormatInt(span.StartTime.UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(span.EndTime.UnixNano(), 10),
+	}
+	keys := make([]string, 0, len(span.Attrs))
+	for k := range span.Attrs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		s.Attributes = append(s.Attributes, attr(k, span.Attrs[k]))
+	}
+	if span.Err != "" {
+		s.Status = otlpStatus{Code: 2, Message: span.Err} // STATUS_CODE_ERROR
+	}
+	span.mu.Unlock()
+
+	data, err := json.Marshal(map[string]interface{}{
+		"resourceSpans": []interface{}{map[string]interface{}{
+			"resource": map[string]interface{}{
+				"attributes": []otlpAttr{attr("service.name", e.serviceName)},
+			},
+			"scopeSpans": []interface{}{map[string]interface{}{
+				"scope": map[string]interface{}{"name": "leaf"},
+				"spans": []otlpSpan{s},
+			}},
+		}},
+	})
+	if err != nil {
+		return
+	}
+	data = append(data, '\n')
+
+	e.mu.Lock()
+	_, _ = e.w.Write(data)
+	e.mu.Unlock()
+}
@@ -0,0 +1,194 @@
+package trace
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/skeletongo/leaf.v1/log"
+)
+
+// Span 链路追踪中的一次处理
+// 方法都可以在 nil 上调用，未开启追踪时不产生任何开销
+type Span struct {
+	TraceID   string // 32 位十六进制
+	SpanID    string // 16 位十六进制
+	ParentID  string // 根 span 为空
+	Name      string
+	StartTime time.Time
+	EndTime   time.Time
+	Attrs     map[string]interface{}
+	Err       string
+
+	mu     sync.Mutex
+	remote bool // 由 Parse 得到的远端 span，只用作父 span
+}
+
+// Exporter span 导出器，必须线程安全
+type Exporter interface {
+	Export(span *Span)
+}
+
+var (
+	muExporter sync.RWMutex
+	exporter   Exporter
+)
+
+// SetExporter 设置导出器，为 nil 时关闭追踪
+func SetExporter(e Exporter) {
+	muExporter.Lock()
+	exporter = e
+	muExporter.Unlock()
+}
+
+// Enabled 是否开启追踪
+func Enabled() bool {
+	muExporter.RLock()
+	defer muExporter.RUnlock()
+	return exporter != nil
+}
+
+func randHex(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// New 开始一条新的链路，未开启追踪时返回 nil
+func New(name string) *Span {
+	if !Enabled() {
+		return nil
+	}
+	return &Span{
+		TraceID:   randHex(16),
+		SpanID:    randHex(8),
+		Name:      name,
+		StartTime: time.Now(),
+	}
+}
+
+// Child 开始一个子 span，s 为 nil 时返回 nil
+func (s *Span) Child(name string) *Span {
+	if s == nil || !Enabled() {
+		return nil
+	}
+	return &Span{
+		TraceID:   s.TraceID,
+		SpanID:    randHex(8),
+		ParentID:  s.SpanID,
+		Name:      name,
+		StartTime: time.Now(),
+	}
+}
+
+func (s *Span) SetAttr(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.Attrs == nil {
+		s.Attrs = make(map[string]interface{})
+	}
+	s.Attrs[key] = value
+	s.mu.Unlock()
+}
+
+func (s *Span) SetError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.mu.Lock()
+	s.Err = err.Error()
+	s.mu.Unlock()
+}
+
+// End 结束并导出，重复调用只导出一次
+func (s *Span) End() {
+	if s == nil || s.remote {
+		return
+	}
+	s.mu.Lock()
+	if !s.EndTime.IsZero() {
+		s.mu.Unlock()
+		return
+	}
+	s.EndTime = time.Now()
+	s.mu.Unlock()
+
+	muExporter.RLock()
+	e := exporter
+	muExporter.RUnlock()
+	if e != nil {
+		e.Export(s)
+	}
+}
+
+// Tag 日志前缀，s 为 nil 时为空
+func (s *Span) Tag() string {
+	if s == nil {
+		return ""
+	}
+	return "[trace:" + s.TraceID + " span:" + s.SpanID + "] "
+}
+
+func (s *Span) Debug(format string, a ...interface{}) {
+	log.Debug("%s%s", s.Tag(), fmt.Sprintf(format, a...))
+}
+
+func (s *Span) Release(format string, a ...interface{}) {
+	log.Release("%s%s", s.Tag(), fmt.Sprintf(format, a...))
+}
+
+func (s *Span) Error(format string, a ...interface{}) {
+	log.Error("%s%s", s.Tag(), fmt.Sprintf(format, a...))
+}
+
+// Traceparent W3C traceparent 格式，用于跨进程传递，例如 cluster 中的服务器间消息
+func (s *Span) Traceparent() string {
+	if s == nil {
+		return ""
+	}
+	return "00-" + s.TraceID + "-" + s.SpanID + "-01"
+}
+
+// Parse 解析 W3C traceparent，得到的 span 只能用作父 span
+// 未开启追踪时返回 nil
+func Parse(traceparent string) (*Span, error) {
+	parts := strings.Split(traceparent, "-")
+	if len(parts) != 4 || len(parts[1]) != 32 || len(parts[2]) != 16 {
+		return nil, errors.New("invalid traceparent: " + traceparent)
+	}
+	for _, p := range parts[1:3] {
+		if _, err := hex.DecodeString(p); err != nil {
+			return nil, errors.New("invalid traceparent: " + traceparent)
+		}
+	}
+	if !Enabled() {
+		return nil, nil
+	}
+	return &Span{TraceID: parts[1], SpanID: parts[2], remote: true}, nil
+}
+
+type spanKey struct{}
+
+// NewContext 返回携带 span 的上下文，span 为 nil 时返回 ctx
+func NewContext(ctx context.Context, span *Span) context.Context {
+	if span == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, spanKey{}, span)
+}
+
+// FromContext 上下文携带的 span
+func FromContext(ctx context.Context) *Span {
+	if ctx == nil {
+		return nil
+	}
+	span, _ := ctx.Value(spanKey{}).(*Span)
+	return span
+}